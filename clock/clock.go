@@ -0,0 +1,76 @@
+/*
+Package clock is the time source of the timeouts of the watchers.
+
+The Real clock is used by default, the tests use a Fake clock which is only
+moved forward by Advance, so the timeouts expire without sleeping.
+*/
+package clock
+
+import "time"
+
+// Clock provides the current time and the timers
+type Clock interface {
+	Now() time.Time
+	// After sends the current time once the duration has elapsed
+	After(d time.Duration) <-chan time.Time
+	// NewTimer is After with a timer which can be stopped
+	NewTimer(d time.Duration) Timer
+	// AfterFunc calls f in its own goroutine once the duration has elapsed, the C of the timer is nil
+	AfterFunc(d time.Duration, f func()) Timer
+	// NewTicker sends the current time every period, the ticks are dropped for a slow receiver
+	NewTicker(period time.Duration) Ticker
+}
+
+// Timer sends the current time on C once, unless it's stopped before
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, it returns false if the timer has already fired or was stopped
+	Stop() bool
+}
+
+// Ticker sends the current time on C every period until it's stopped
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the clock of the OS
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+func (realClock) NewTicker(period time.Duration) Ticker {
+	return realTicker{time.NewTicker(period)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,158 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock which only moves forward when Advance is called, its timers and
+// tickers fire as soon as the time has been advanced past them
+type Fake struct {
+	mu sync.Mutex
+	// now is the time of the clock, it's moved to every timer while it fires
+	now    time.Time
+	timers []*fakeTimer
+	// changed is broadcast when a timer is added, for BlockUntil
+	changed *sync.Cond
+}
+
+// NewFake returns a fake clock set to the given time
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+// fakeTimer is a timer or a ticker if it has a period, it calls fn instead of sending on ch if it's set
+type fakeTimer struct {
+	clock  *Fake
+	at     time.Time
+	ch     chan time.Time
+	period time.Duration
+	fn     func()
+}
+
+// Now returns the time of the fake clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// After fires when the clock is advanced by the duration
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer returns a timer which fires when the clock is advanced by the duration
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.add(&fakeTimer{clock: f, ch: make(chan time.Time, 1)}, d)
+}
+
+// AfterFunc calls f when the clock is advanced by the duration
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.add(&fakeTimer{clock: f, fn: fn}, d)
+}
+
+// NewTicker returns a ticker which fires every time the clock is advanced by the period
+func (f *Fake) NewTicker(period time.Duration) Ticker {
+	if period <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.add(&fakeTimer{clock: f, ch: make(chan time.Time, 1), period: period}, period)}
+}
+
+func (f *Fake) add(t *fakeTimer, d time.Duration) *fakeTimer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.at = f.now.Add(d)
+	if d <= 0 {
+		t.fire()
+		return t
+	}
+	f.timers = append(f.timers, t)
+	f.changed.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward and fires the timers which are due by then in the order of their time,
+// a ticker fires once for every period which has elapsed
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	end := f.now.Add(d)
+	for {
+		sort.SliceStable(f.timers, func(i, j int) bool {
+			return f.timers[i].at.Before(f.timers[j].at)
+		})
+		if len(f.timers) == 0 || f.timers[0].at.After(end) {
+			break
+		}
+		t := f.timers[0]
+		f.now = t.at
+		t.fire()
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+		} else {
+			f.timers = f.timers[1:]
+		}
+	}
+	f.now = end
+}
+
+// fire must be called with the mutex of the clock held
+func (t *fakeTimer) fire() {
+	if t.fn != nil {
+		go t.fn()
+		return
+	}
+	select {
+	case t.ch <- t.clock.now:
+	default:
+		// the receiver has not picked up the previous tick yet
+	}
+}
+
+// Timers returns the number of timers and tickers which have not fired yet, the tickers are always pending
+func (f *Fake) Timers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+// BlockUntil waits until at least n timers and tickers are pending, e.g. until the goroutines
+// under test have started the timers which are expected to fire by the next Advance
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.timers) < n {
+		f.changed.Wait()
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+// fakeTicker is a periodic fakeTimer, its Stop has no result
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+func (t *fakeTimer) Stop() bool {
+	f := t.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, pending := range f.timers {
+		if pending == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
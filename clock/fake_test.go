@@ -0,0 +1,43 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+	late := c.After(2 * time.Second)
+	early := c.After(time.Second)
+	stopped := c.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Errorf("Stop(): got %v, want %v", false, true)
+	}
+	if c.Timers() != 2 {
+		t.Errorf("Timers(): got %d, want %d", c.Timers(), 2)
+	}
+
+	c.Advance(time.Second)
+	select {
+	case now := <-early:
+		if !now.Equal(start.Add(time.Second)) {
+			t.Errorf("After(): got %v, want %v", now, start.Add(time.Second))
+		}
+	default:
+		t.Errorf("After(): the timer has not fired")
+	}
+	select {
+	case <-late:
+		t.Errorf("After(): the timer has fired too early")
+	case <-stopped.C():
+		t.Errorf("Stop(): the stopped timer has fired")
+	default:
+	}
+
+	c.Advance(time.Second)
+	<-late
+	if c.Timers() != 0 {
+		t.Errorf("Timers(): got %d, want %d", c.Timers(), 0)
+	}
+}
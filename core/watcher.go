@@ -1,11 +1,100 @@
 package core
 
-import "github.com/sevigo/notify/event"
+import (
+	"context"
+	"time"
+
+	"github.com/sevigo/notify/clock"
+	"github.com/sevigo/notify/event"
+)
+
+// SymlinkPolicy defines how the symlinks below the watched path are handled
+type SymlinkPolicy int
+
+const (
+	// SymlinkReport reports the changes of the links themselves, the targets are not watched
+	SymlinkReport SymlinkPolicy = iota
+	// SymlinkIgnore drops the links from the scans and from the events
+	SymlinkIgnore
+	// SymlinkFollow treats the links like their targets, linked directories are
+	// watched and scanned like sub-directories, each of them only once
+	SymlinkFollow
+)
 
 type WatchingOptions struct {
+	// Backend is the name of a registered backend, e.g. "inotify", "fanotify", "fsnotify" or "poll".
+	// The backend of the global options or the default backend of the OS is used if it's empty.
+	//
+	// "poll" watches the path by comparing snapshots of its directories instead of using the
+	// notifications of the OS, e.g. for NFS, SMB or FUSE mounts. "fanotify" watches the whole
+	// file system of the path with a single fanotify mark instead of an inotify watch per
+	// directory, only the changes below the path are reported. It needs Linux 5.9 and the
+	// CAP_SYS_ADMIN capability, the renames are paired since Linux 5.17
+	Backend string
+
 	Rescan        bool
 	Recursive     bool
 	ActionFilters []event.ActionType
+	// ReadEvents enables FileOpened, FileAccessed and FileClosedNoWrite, only supported by inotify
+	ReadEvents bool
+	// Raw adds the backend specific records to the events and reports the records
+	// which can't be mapped to an action as event.Invalid
+	Raw bool
+	// WaitForRoot keeps the watch running if the root is deleted, moved away or unmounted,
+	// the watch is resumed with a reconciliation scan as soon as the path exists again.
+	// Without it the watch ends with the WatchRootLost event, only supported by inotify and fsnotify
+	WaitForRoot bool
+	// WaitForCreation starts the watch even if the path doesn't exist yet, the nearest existing
+	// ancestor is watched until the path is created, then its initial contents are reported
+	WaitForCreation bool
+	// ResolveSymlinks reports FileModified for the symlinks to files whose resolved content was changed
+	// by swapping a link, e.g. the ..data link of a mounted Kubernetes ConfigMap or Secret
+	ResolveSymlinks bool
+	// SymlinkPolicy defines how the symlinks are handled, they are reported by default
+	SymlinkPolicy SymlinkPolicy
+	// OneFileSystem skips the directories on other file systems than the watched path, like find -xdev
+	OneFileSystem bool
+	// ExcludeFSTypes skips the directories on the file systems of these types, e.g. "proc", "sysfs", "nfs" or "fuse"
+	ExcludeFSTypes []string
+
+	// PollInterval is the time between two polls of an active directory, one second by default
+	PollInterval time.Duration
+	// PollMaxInterval limits the back-off of the directories without changes, their poll interval
+	// is doubled by every poll up to it. 32 times PollInterval by default
+	PollMaxInterval time.Duration
+	// PollBudget limits the stat calls per second of the polls of this watch, unlimited by default
+	PollBudget int
+	// ProcessInfo adds the process which made the change to the events, it's only provided by
+	// the fanotify backend. The executable, the command line and the UID are read from /proc
+	ProcessInfo bool
+	// MaxKernelWatches limits the inotify watches of a recursive watch, the other directories
+	// are polled like after the watch limit of the OS was reached. Unlimited by default
+	MaxKernelWatches int
+	// Clock runs the timers of the watch: the debouncing, the pairing of the renames, the polls and
+	// the waits for the root. The clock of the global options or the real clock is used by default
+	Clock clock.Clock
+
+	// EventCh and ErrorCh are used for this watch instead of the shared Event() and Error() channels
+	EventCh chan event.Event
+	ErrorCh chan event.Error
+	// EventHandler and ErrorHandler are called for this watch instead of sending to a channel
+	EventHandler func(event.Event)
+	ErrorHandler func(event.Error)
+}
+
+// Watch is a handle for a single path returned by StartWatching
+type Watch interface {
+	// Stop stops watching the path and waits until the backend is released,
+	// cancelling the context passed to StartWatching has the same effect
+	Stop()
+	// Done is closed when the watch is ended
+	Done() <-chan struct{}
+	// Err returns the reason why the watch was ended, or nil if it was stopped
+	Err() error
+	// Path returns the watched path
+	Path() string
+	// Options returns the options the watch was started with
+	Options() WatchingOptions
 }
 
 // DirectoryWatcher interface
@@ -13,6 +102,6 @@ type DirectoryWatcher interface {
 	Event() chan event.Event
 	Error() chan event.Error
 	RescanAll()
-	StartWatching(path string, options *WatchingOptions)
+	StartWatching(ctx context.Context, path string, options *WatchingOptions) (Watch, error)
 	StopWatching(path string)
 }
@@ -24,6 +24,20 @@ type Error struct {
 	Stack   string
 	Message string
 	Level   string
+	// Path is the watched path the error belongs to, it's only set for the structured errors
+	Path string
+	// Degradation is set if the watch is partly served by polling
+	Degradation *Degradation
+}
+
+// Degradation describes a watch which has fallen back to polling for some directories
+type Degradation struct {
+	// Reason is why the directories are polled, e.g. the watch limit of the OS
+	Reason string
+	// KernelDirs is the number of directories watched with the notifications of the OS
+	KernelDirs int
+	// PolledDirs is the number of polled directories
+	PolledDirs int
 }
 
 // FormatError returns formattet error message
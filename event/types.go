@@ -1,6 +1,11 @@
 package event
 
-import "time"
+import (
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // ActionType represents what happens with the file
 type ActionType int
@@ -12,12 +17,114 @@ type MetaInfo map[string]string
 type Event struct {
 	Action ActionType
 	Path   string
+	// Root is the watched path which has produced the event
+	Root string
+	// RelativePath is the Path relative to the Root
+	RelativePath string
+	// Seq is a monotonically increasing number assigned when the event is sent
+	Seq uint64
+	// DetectedAt is the time when the change was detected
+	DetectedAt time.Time
+	// ChangedAttributes is set for FileAttributesChanged, it's empty if the previous attributes are unknown
+	ChangedAttributes Attribute
+	// Raw holds the backend specific records of this event in the order they were reported,
+	// it's only set if the raw mode is enabled for the watch
+	Raw []interface{}
+	// Process is the process which made the change, it's only set if the backend reports it
+	Process *Process
 	AdditionalInfo
 }
 
+// Process describes the process which made a change, the fields which can't be
+// resolved are empty, e.g. if the process has already exited
+type Process struct {
+	PID     int
+	Exe     string
+	Cmdline []string
+	// UID is the real user id of the process, nil if it's unknown
+	UID *uint32
+}
+
+// Sequence generates the sequence numbers of the events
+type Sequence struct {
+	last atomic.Uint64
+
+	mu sync.Mutex
+	// sending holds a lock per channel, only one event of a channel is numbered and sent at a time
+	sending map[chan Event]*channelLock
+}
+
+// channelLock serializes the sends on a channel, it's removed when no send is waiting for it
+type channelLock struct {
+	sem   chan struct{}
+	users int
+}
+
+// Next returns the next sequence number, the first one is 1
+func (s *Sequence) Next() uint64 {
+	return s.last.Add(1)
+}
+
+// Send numbers the event and sends it on the channel unless done is closed before,
+// the events sent on the same channel are received in the order of their numbers
+func (s *Sequence) Send(ch chan Event, data Event, done <-chan struct{}) {
+	l := s.lock(ch)
+	defer s.unlock(ch, l)
+	select {
+	case l.sem <- struct{}{}:
+	case <-done:
+		return
+	}
+	defer func() {
+		<-l.sem
+	}()
+	data.Seq = s.Next()
+	select {
+	case ch <- data:
+	case <-done:
+	}
+}
+
+func (s *Sequence) lock(ch chan Event) *channelLock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sending == nil {
+		s.sending = make(map[chan Event]*channelLock)
+	}
+	l, ok := s.sending[ch]
+	if !ok {
+		l = &channelLock{sem: make(chan struct{}, 1)}
+		s.sending[ch] = l
+	}
+	l.users++
+	return l
+}
+
+func (s *Sequence) unlock(ch chan Event, l *channelLock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l.users--
+	if l.users == 0 {
+		delete(s.sending, ch)
+	}
+}
+
+// AdditionalInfo holds the metadata of the file, it's empty for removed files
 type AdditionalInfo struct {
 	Size    int64
 	ModTime time.Time
+	Mode    fs.FileMode
+	UID     uint32
+	GID     uint32
+	Inode   uint64
+	Device  uint64
+	Nlink   uint64
+	// AccessTime and ChangeTime are not provided on every platform
+	AccessTime time.Time
+	ChangeTime time.Time
+	// IsSymlink is true if the entry itself is a symbolic link,
+	// all other fields describe the link and not its target
+	IsSymlink bool
 	// used if file was renamed
 	OldName string
 }
@@ -35,4 +142,54 @@ const (
 	FileRenamedOldName // 4
 	// FileRenamedNewName - the file was renamed and this is the new name.
 	FileRenamedNewName // 5
+	// DirAdded - the directory was added.
+	DirAdded // 6
+	// DirRemoved - the directory was removed.
+	DirRemoved // 7
+	// DirRenamed - the directory was renamed, OldName holds the previous path.
+	DirRenamed // 8
+	// FileAttributesChanged - the permissions, the owner, the time stamps or the extended attributes were changed.
+	FileAttributesChanged // 9
+	// FileOpened - the file was opened, only reported if ReadEvents are enabled.
+	FileOpened // 10
+	// FileAccessed - the file was read, only reported if ReadEvents are enabled.
+	FileAccessed // 11
+	// FileClosedNoWrite - the file opened for reading was closed, only reported if ReadEvents are enabled.
+	FileClosedNoWrite // 12
+	// WatchRootLost - the watched root was deleted, moved away or unmounted.
+	WatchRootLost // 13
+	// FileReplaced - the file was replaced, e.g. a new file was renamed over it or it was removed and created again.
+	FileReplaced // 14
 )
+
+// Attribute is a set of file attributes changed by a FileAttributesChanged event
+type Attribute uint32
+
+const (
+	// AttributeMode - the permissions or the file mode were changed.
+	AttributeMode Attribute = 1 << iota
+	// AttributeOwner - the user or the group were changed.
+	AttributeOwner
+	// AttributeTimes - the modification or the access time was changed.
+	AttributeTimes
+	// AttributeExtended - none of the attributes above was changed, e.g. extended attributes or ACLs.
+	AttributeExtended
+)
+
+// Changes returns the attributes which differ from the previous metadata
+func (info AdditionalInfo) Changes(previous AdditionalInfo) Attribute {
+	var changed Attribute
+	if info.Mode != previous.Mode {
+		changed |= AttributeMode
+	}
+	if info.UID != previous.UID || info.GID != previous.GID {
+		changed |= AttributeOwner
+	}
+	if !info.ModTime.Equal(previous.ModTime) || !info.AccessTime.Equal(previous.AccessTime) {
+		changed |= AttributeTimes
+	}
+	if changed == 0 {
+		changed = AttributeExtended
+	}
+	return changed
+}
@@ -0,0 +1,45 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdditionalInfo_Changes(t *testing.T) {
+	now := time.Now()
+	previous := AdditionalInfo{
+		Mode:    0o600,
+		UID:     1000,
+		GID:     1000,
+		ModTime: now,
+	}
+
+	tests := []struct {
+		name string
+		info AdditionalInfo
+		want Attribute
+	}{
+		{
+			name: "mode",
+			info: AdditionalInfo{Mode: 0o644, UID: 1000, GID: 1000, ModTime: now},
+			want: AttributeMode,
+		},
+		{
+			name: "owner and times",
+			info: AdditionalInfo{Mode: 0o600, UID: 0, GID: 1000, ModTime: now.Add(time.Second)},
+			want: AttributeOwner | AttributeTimes,
+		},
+		{
+			name: "nothing visible",
+			info: previous,
+			want: AttributeExtended,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.Changes(previous); got != tt.want {
+				t.Errorf("Changes(): got %b, want %b", got, tt.want)
+			}
+		})
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/sevigo/notify/clock"
 )
 
 // Waiter ...
@@ -21,65 +23,258 @@ type Waiter struct {
 	ErrorCh  chan Error
 	Timeout  time.Duration
 	MaxCount int
+	// Done drops all pending notifications when it is closed
+	Done <-chan struct{}
+	// Sequence numbers the events when they are sent
+	Sequence *Sequence
+	// Clock runs the timeouts, the real clock is used if it's nil
+	Clock clock.Clock
+
+	notificationsMutex sync.Mutex
+	notificationsChans map[string]*notification
+	// flush is closed by Flush() to send the notifications registered before
+	flush chan struct{}
 }
 
-var notificationsMutex sync.Mutex
-var notificationsChans = make(map[string]chan Event)
+// notification is a pending notification for a single file path
+type notification struct {
+	ch    chan Event
+	flush chan struct{}
+	// deadline is moved by every notification, the event is sent when it's reached
+	deadline time.Time
+	// info is the metadata of the last merged change
+	info *AdditionalInfo
+	// created is set if the path was created again by a merged change and not removed after that
+	created bool
+	// sent is closed when Wait() has returned
+	sent chan struct{}
+}
 
 // RegisterFileNotification channel for a given file path, use this channel for with FileNotificationWaiter() function
 func (w *Waiter) RegisterFileNotification(path string) {
-	waitChan := make(chan Event)
-	notificationsMutex.Lock()
-	defer notificationsMutex.Unlock()
-	notificationsChans[path] = waitChan
+	n := &notification{
+		ch:       make(chan Event, 1),
+		sent:     make(chan struct{}),
+		deadline: w.clock().Now().Add(w.Timeout),
+	}
+	w.notificationsMutex.Lock()
+	defer w.notificationsMutex.Unlock()
+	if w.notificationsChans == nil {
+		w.notificationsChans = make(map[string]*notification)
+	}
+	n.flush = w.flushChan()
+	w.notificationsChans[path] = n
 }
 
 // UnregisterFileNotification channel for a given file path
 func (w *Waiter) UnregisterFileNotification(path string) {
-	notificationsMutex.Lock()
-	defer notificationsMutex.Unlock()
-	delete(notificationsChans, path)
+	w.notificationsMutex.Lock()
+	defer w.notificationsMutex.Unlock()
+	delete(w.notificationsChans, path)
+}
+
+// unregister removes the notification of the path unless it was registered again in the meantime
+func (w *Waiter) unregister(path string, n *notification) {
+	w.notificationsMutex.Lock()
+	defer w.notificationsMutex.Unlock()
+	if w.notificationsChans[path] == n {
+		delete(w.notificationsChans, path)
+	}
 }
 
 // LookupForFileNotification returns a channel for a given file path
 func (w *Waiter) LookupForFileNotification(path string) (chan Event, bool) {
-	notificationsMutex.Lock()
-	defer notificationsMutex.Unlock()
-	data, ok := notificationsChans[path]
-	return data, ok
+	w.notificationsMutex.Lock()
+	defer w.notificationsMutex.Unlock()
+	n, ok := w.notificationsChans[path]
+	if !ok {
+		return nil, false
+	}
+	return n.ch, true
+}
+
+// Notify passes the event to the running Wait() for a given file path,
+// it returns false if no notification is registered for the path
+func (w *Waiter) Notify(path string, data Event) bool {
+	w.notificationsMutex.Lock()
+	defer w.notificationsMutex.Unlock()
+	n, ok := w.notificationsChans[path]
+	if !ok {
+		return false
+	}
+	now := w.clock().Now()
+	if !now.Before(n.deadline) {
+		// the notification is about to be sent, the change gets a new one
+		return false
+	}
+	n.deadline = now.Add(w.Timeout)
+	if !data.ModTime.IsZero() {
+		info := data.AdditionalInfo
+		n.info = &info
+	}
+	switch data.Action {
+	case FileAdded, FileReplaced, DirAdded:
+		n.created = true
+	case FileRemoved, DirRemoved:
+		n.created = false
+	}
+	select {
+	case n.ch <- data:
+	default:
+		// Wait() has not picked up the previous notification yet
+	}
+	return true
 }
 
 // Wait will send fileData to the chan stored in CallbackData after 5 seconds
 // if no signal is received on waitChan.
 // TODO: this can be done better with a general type of channel and any data
 func (w *Waiter) Wait(fileNotificationKey string, fileData *Event) {
-	waitChan, exists := w.LookupForFileNotification(fileNotificationKey)
+	w.notificationsMutex.Lock()
+	n, exists := w.notificationsChans[fileNotificationKey]
+	w.notificationsMutex.Unlock()
 	if !exists {
 		w.ErrorCh <- FormatError("ERROR", fmt.Sprintf("no notification if registered for the path %s", fileNotificationKey))
 		return
 	}
+	waitChan := n.ch
 	defer func() {
-		w.UnregisterFileNotification(fileNotificationKey)
+		w.unregister(fileNotificationKey, n)
 		close(waitChan)
+		close(n.sent)
+	}()
+	// the notification is removed before the event is sent, a change reported
+	// after the event was received gets a new notification
+	send := func(data Event) {
+		w.unregister(fileNotificationKey, n)
+		w.send(data)
+	}
+
+	timer := w.clock().NewTimer(w.remaining(n))
+	defer func() {
+		timer.Stop()
 	}()
 
 	cnt := 0
 	for {
 		select {
 		case data := <-waitChan:
-			if data.Action == FileRenamedNewName {
+			if data.Action == FileRenamedNewName || data.Action == DirRenamed {
 				// if we got file rename data, just send it
-				w.EventCh <- data
+				send(data)
 				return
 			}
+			// keep the records of the merged notifications
+			fileData.Raw = append(fileData.Raw, data.Raw...)
+			if data.Process != nil {
+				// the process of the last change is reported
+				fileData.Process = data.Process
+			}
 			cnt++
 			if cnt == w.MaxCount {
 				w.ErrorCh <- FormatError("ERROR", fmt.Sprintf("exit after %d times of notification for [%s]", w.MaxCount, fileData.Path))
-				w.UnregisterFileNotification(fileNotificationKey)
+				w.unregister(fileNotificationKey, n)
 			}
-		case <-time.After(w.Timeout):
-			w.EventCh <- *fileData
+		case <-timer.C():
+			if remaining := w.remaining(n); remaining > 0 {
+				// the notifications received in the meantime have moved the deadline
+				timer = w.clock().NewTimer(remaining)
+				continue
+			}
+			w.refresh(n, fileData)
+			send(*fileData)
+			return
+		case <-n.flush:
+			w.refresh(n, fileData)
+			send(*fileData)
+			return
+		case <-w.Done:
+			return
+		}
+	}
+}
+
+// Flush sends all pending notifications without waiting for the timeout and
+// returns when they are sent, the notifications registered later are not affected
+func (w *Waiter) Flush() {
+	w.notificationsMutex.Lock()
+	close(w.flushChan())
+	w.flush = nil
+	pending := make([]*notification, 0, len(w.notificationsChans))
+	for _, n := range w.notificationsChans {
+		pending = append(pending, n)
+	}
+	w.notificationsMutex.Unlock()
+
+	for _, n := range pending {
+		select {
+		case <-n.sent:
+		case <-w.Done:
 			return
 		}
 	}
 }
+
+// Send delivers the event right away unless the waiter is done
+func (w *Waiter) Send(data Event) {
+	w.send(data)
+}
+
+// refresh sets the metadata of the last merged change, the old name of a rename is kept.
+// A removed path which was created again is reported as replaced, not as removed
+func (w *Waiter) refresh(n *notification, data *Event) {
+	w.notificationsMutex.Lock()
+	defer w.notificationsMutex.Unlock()
+	if n.created {
+		switch data.Action {
+		case FileRemoved:
+			data.Action = FileReplaced
+		case DirRemoved:
+			// there is no replacement of a directory, its new contents are reported on their own
+			data.Action = DirAdded
+		}
+	}
+	if n.info == nil {
+		return
+	}
+	oldName := data.OldName
+	data.AdditionalInfo = *n.info
+	if data.OldName == "" {
+		data.OldName = oldName
+	}
+}
+
+// remaining returns the time until the deadline of the notification
+func (w *Waiter) remaining(n *notification) time.Duration {
+	w.notificationsMutex.Lock()
+	defer w.notificationsMutex.Unlock()
+	return n.deadline.Sub(w.clock().Now())
+}
+
+func (w *Waiter) clock() clock.Clock {
+	if w.Clock == nil {
+		return clock.Real
+	}
+	return w.Clock
+}
+
+// flushChan must be called with the notificationsMutex held
+func (w *Waiter) flushChan() chan struct{} {
+	if w.flush == nil {
+		w.flush = make(chan struct{})
+	}
+	return w.flush
+}
+
+// send delivers the event unless the waiter is done
+func (w *Waiter) send(data Event) {
+	if w.Sequence != nil {
+		// the concurrent Wait() calls must not send their numbers out of order
+		w.Sequence.Send(w.EventCh, data, w.Done)
+		return
+	}
+	select {
+	case w.EventCh <- data:
+	case <-w.Done:
+	}
+}
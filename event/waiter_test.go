@@ -12,6 +12,8 @@ package event
 import (
 	"testing"
 	"time"
+
+	"github.com/sevigo/notify/clock"
 )
 
 func TestNotificationWaiter_RegisterFileNotification(t *testing.T) {
@@ -35,7 +37,7 @@ func TestNotificationWaiter_RegisterFileNotification(t *testing.T) {
 			name: "test 1: notification is fired after Timeout",
 			fields: fields{
 				EventCh:  make(chan Event),
-				Timeout:  time.Duration(1 * time.Millisecond),
+				Timeout:  time.Second,
 				MaxCount: 10,
 			},
 			args: args{
@@ -66,10 +68,12 @@ func TestNotificationWaiter_RegisterFileNotification(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
 			w := &Waiter{
 				EventCh:  tt.fields.EventCh,
 				Timeout:  tt.fields.Timeout,
 				MaxCount: tt.fields.MaxCount,
+				Clock:    c,
 			}
 			w.RegisterFileNotification(tt.args.path)
 			waitChan, exists := w.LookupForFileNotification(tt.args.path)
@@ -85,6 +89,8 @@ func TestNotificationWaiter_RegisterFileNotification(t *testing.T) {
 			go w.Wait(tt.fileData.Path, tt.fileData)
 			waitChan <- *tt.fileData
 			if tt.notificationExpected {
+				c.BlockUntil(1)
+				c.Advance(tt.fields.Timeout)
 				file := <-tt.fields.EventCh
 				if file.Path != tt.fileData.Path {
 					t.Errorf("FileChangeNotification: got AbsolutePath=%s, want %s", file.Path, tt.fileData.Path)
@@ -99,3 +105,163 @@ func TestNotificationWaiter_RegisterFileNotification(t *testing.T) {
 		})
 	}
 }
+
+func TestWaiter_Done(t *testing.T) {
+	done := make(chan struct{})
+	w := &Waiter{
+		EventCh:  make(chan Event),
+		Timeout:  time.Hour,
+		MaxCount: 10,
+		Done:     done,
+	}
+	path := "/foo/bar/test.txt"
+	w.RegisterFileNotification(path)
+
+	finished := make(chan struct{})
+	go func() {
+		w.Wait(path, &Event{Action: FileAdded, Path: path})
+		close(finished)
+	}()
+	close(done)
+	<-finished
+
+	select {
+	case e := <-w.EventCh:
+		t.Errorf("Wait(): got event %v after Done was closed", e)
+	default:
+	}
+	if w.Notify(path, Event{Action: FileModified, Path: path}) {
+		t.Errorf("Notify(): got %v, want %v", true, false)
+	}
+}
+
+func TestWaiter_Deadline(t *testing.T) {
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	w := &Waiter{
+		EventCh:  make(chan Event),
+		Timeout:  time.Second,
+		MaxCount: 10,
+		Clock:    c,
+	}
+	path := "/foo/bar/test.txt"
+	w.RegisterFileNotification(path)
+	go w.Wait(path, &Event{Action: FileAdded, Path: path})
+
+	// every notification moves the deadline by the timeout
+	c.BlockUntil(1)
+	c.Advance(900 * time.Millisecond)
+	if !w.Notify(path, Event{Action: FileModified, Path: path}) {
+		t.Fatalf("Notify(): got %v, want %v", false, true)
+	}
+	c.Advance(100 * time.Millisecond)
+	c.BlockUntil(1)
+	select {
+	case e := <-w.EventCh:
+		t.Fatalf("Wait(): got event %v before the deadline", e)
+	default:
+	}
+	c.Advance(900 * time.Millisecond)
+	// the expired notification is about to be sent, a new change must not be merged with it
+	if w.Notify(path, Event{Action: FileRemoved, Path: path}) {
+		t.Errorf("Notify(): got %v, want %v", true, false)
+	}
+	if e := <-w.EventCh; e.Action != FileAdded {
+		t.Errorf("Wait(): got action %v, want %v", e.Action, FileAdded)
+	}
+}
+
+func TestWaiter_Flush(t *testing.T) {
+	w := &Waiter{
+		EventCh:  make(chan Event, 1),
+		Timeout:  time.Hour,
+		MaxCount: 10,
+	}
+	path := "/foo/bar/test.txt"
+	w.RegisterFileNotification(path)
+	go w.Wait(path, &Event{Action: FileAdded, Path: path})
+
+	w.Flush()
+	select {
+	case e := <-w.EventCh:
+		if e.Path != path {
+			t.Errorf("Flush(): got path %s, want %s", e.Path, path)
+		}
+	default:
+		t.Errorf("Flush(): the pending event was not sent")
+	}
+}
+
+func TestWaiter_Sequence(t *testing.T) {
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	w := &Waiter{
+		EventCh:  make(chan Event),
+		Timeout:  time.Second,
+		MaxCount: 10,
+		Sequence: &Sequence{},
+		Clock:    c,
+	}
+	for i, path := range []string{"/foo/a.txt", "/foo/b.txt"} {
+		w.RegisterFileNotification(path)
+		go w.Wait(path, &Event{Action: FileAdded, Path: path})
+		c.BlockUntil(1)
+		c.Advance(time.Second)
+		e := <-w.EventCh
+		if e.Seq != uint64(i+1) {
+			t.Errorf("Wait(): got Seq=%d, want %d", e.Seq, i+1)
+		}
+	}
+}
+
+func TestWaiter_SequenceOrder(t *testing.T) {
+	w := &Waiter{
+		EventCh:  make(chan Event),
+		Sequence: &Sequence{},
+	}
+	// the concurrent sends on one channel are received in the order of their numbers
+	const count = 100
+	for i := 0; i < count; i++ {
+		go w.Send(Event{Action: FileAdded})
+	}
+	var last uint64
+	for i := 0; i < count; i++ {
+		e := <-w.EventCh
+		if e.Seq <= last {
+			t.Fatalf("Send(): got Seq=%d after %d", e.Seq, last)
+		}
+		last = e.Seq
+	}
+}
+
+func TestWaiter_NotifyAfterSend(t *testing.T) {
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	w := &Waiter{
+		EventCh:  make(chan Event),
+		Timeout:  time.Second,
+		MaxCount: 10,
+		Clock:    c,
+	}
+	path := "/foo/bar/test.txt"
+	w.RegisterFileNotification(path)
+	go w.Wait(path, &Event{Action: FileAdded, Path: path})
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+
+	// a change reported when the deadline is reached gets a new notification instead of
+	// being merged, the new one is kept when the first event is sent after it's registered
+	if w.Notify(path, Event{Action: FileModified, Path: path}) {
+		t.Errorf("Notify(): got %v, want %v", true, false)
+	}
+	w.RegisterFileNotification(path)
+	go w.Wait(path, &Event{Action: FileModified, Path: path})
+	if e := <-w.EventCh; e.Action != FileAdded {
+		t.Errorf("Wait(): got action %v, want %v", e.Action, FileAdded)
+	}
+	if _, exists := w.LookupForFileNotification(path); !exists {
+		t.Fatalf("LookupForFileNotification(): the new notification is removed with the sent one")
+	}
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	if e := <-w.EventCh; e.Action != FileModified {
+		t.Errorf("Wait(): got action %v, want %v", e.Action, FileModified)
+	}
+}
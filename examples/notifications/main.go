@@ -35,16 +35,16 @@ func main() {
 	w := notify.Setup(ctx, &watcher.Options{})
 
 	for _, dir := range dirs {
-		go w.StartWatching(dir, &core.WatchingOptions{
+		watch, err := w.StartWatching(ctx, dir, &core.WatchingOptions{
 			Rescan:    true,
 			Recursive: true,
 		})
-	}
-	defer func() {
-		for _, dir := range dirs {
-			w.StopWatching(dir)
+		if err != nil {
+			log.Printf("[ERROR] %v", err)
+			continue
 		}
-	}()
+		defer watch.Stop()
+	}
 
 	log.Println("wait for file change events ...")
 	for {
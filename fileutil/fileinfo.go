@@ -52,9 +52,10 @@ func Checksum(absoluteFilePath string) (string, error) {
 	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
+// CheckValidFile returns the file info if the file or directory of the event still exists
 func CheckValidFile(absoluteFilePath string, action event.ActionType) (fs.FileInfo, error) {
 	// if the file is removed we are good and the event is valid
-	if action == event.FileRemoved {
+	if action == event.FileRemoved || action == event.DirRemoved {
 		return nil, nil
 	}
 	if action == event.FileRenamedOldName {
@@ -66,8 +67,5 @@ func CheckValidFile(absoluteFilePath string, action event.ActionType) (fs.FileIn
 	if err != nil {
 		return nil, err
 	}
-	if starts.IsDir() {
-		return nil, fmt.Errorf("not a file")
-	}
 	return starts, nil
 }
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/sevigo/notify/event"
 )
 
 func TestChecksum(t *testing.T) {
@@ -67,3 +69,49 @@ func TestContentType(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckValidFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		filePath string
+		action   event.ActionType
+		isDir    bool
+		wantErr  bool
+	}{
+		{
+			name:     "file",
+			filePath: "testdata/test.txt",
+			action:   event.FileModified,
+		},
+		{
+			name:     "directory",
+			filePath: "testdata",
+			action:   event.DirAdded,
+			isDir:    true,
+		},
+		{
+			name:     "removed",
+			filePath: "testdata/wrong.txt",
+			action:   event.FileRemoved,
+		},
+		{
+			name:     "missing",
+			filePath: "testdata/wrong.txt",
+			action:   event.FileAdded,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CheckValidFile(tt.filePath, tt.action)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if got != nil {
+				assert.Equal(t, tt.isDir, got.IsDir())
+			}
+		})
+	}
+}
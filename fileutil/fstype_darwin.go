@@ -0,0 +1,21 @@
+package fileutil
+
+import (
+	"syscall"
+)
+
+// FSType returns the name of the file system type of the path, e.g. "apfs" or "nfs"
+func FSType(absoluteFilePath string) (string, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(absoluteFilePath, &stat); err != nil {
+		return "", err
+	}
+	name := make([]byte, 0, len(stat.Fstypename))
+	for _, c := range stat.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name), nil
+}
@@ -0,0 +1,54 @@
+package fileutil
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// fsMagics maps the statfs magic numbers to the names used by /proc/filesystems
+var fsMagics = map[uint32]string{
+	0x0187:     "autofs",
+	0x00c36400: "ceph",
+	0x42494e4d: "binfmt_misc",
+	0x9123683e: "btrfs",
+	0x27e0eb:   "cgroup",
+	0x63677270: "cgroup2",
+	0xff534d42: "cifs",
+	0x62656570: "configfs",
+	0x64626720: "debugfs",
+	0x1cd1:     "devpts",
+	0xef53:     "ext4",
+	0x65735546: "fuse",
+	0x65735543: "fusectl",
+	0x958458f6: "hugetlbfs",
+	0x9660:     "iso9660",
+	0x19800202: "mqueue",
+	0x6969:     "nfs",
+	0x6e736673: "nsfs",
+	0x794c7630: "overlay",
+	0x9fa0:     "proc",
+	0x6165676c: "pstore",
+	0x858458f6: "ramfs",
+	0x73636673: "securityfs",
+	0x517b:     "smb",
+	0xfe534d42: "smb2",
+	0x73717368: "squashfs",
+	0x62656572: "sysfs",
+	0x01021994: "tmpfs",
+	0x74726163: "tracefs",
+	0x4d44:     "vfat",
+	0x58465342: "xfs",
+	0x2fc12fc1: "zfs",
+}
+
+// FSType returns the name of the file system type of the path, e.g. "ext4" or "proc"
+func FSType(absoluteFilePath string) (string, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(absoluteFilePath, &stat); err != nil {
+		return "", err
+	}
+	if name, ok := fsMagics[uint32(stat.Type)]; ok {
+		return name, nil
+	}
+	return fmt.Sprintf("0x%x", stat.Type), nil
+}
@@ -0,0 +1,17 @@
+package fileutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSType(t *testing.T) {
+	name, err := FSType("/proc")
+	require.NoError(t, err)
+	assert.Equal(t, "proc", name)
+
+	_, err = FSType("testdata/wrong.txt")
+	assert.Error(t, err)
+}
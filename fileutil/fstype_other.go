@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package fileutil
+
+import (
+	"errors"
+)
+
+// FSType is not supported on the other platforms
+func FSType(_ string) (string, error) {
+	return "", errors.New("the file system type is not supported on this platform")
+}
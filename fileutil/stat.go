@@ -0,0 +1,31 @@
+package fileutil
+
+import (
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/sevigo/notify/event"
+)
+
+// Stat returns the metadata of the file, symbolic links are not followed
+func Stat(absoluteFilePath string) (*event.AdditionalInfo, error) {
+	fileInfo, err := os.Lstat(path.Clean(absoluteFilePath))
+	if err != nil {
+		return nil, err
+	}
+	info := Info(fileInfo)
+	return &info, nil
+}
+
+// Info converts the file info to the metadata of an event
+func Info(fileInfo fs.FileInfo) event.AdditionalInfo {
+	info := event.AdditionalInfo{
+		Size:      fileInfo.Size(),
+		ModTime:   fileInfo.ModTime(),
+		Mode:      fileInfo.Mode(),
+		IsSymlink: fileInfo.Mode()&fs.ModeSymlink != 0,
+	}
+	fillSysInfo(&info, fileInfo)
+	return info
+}
@@ -0,0 +1,44 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStat(t *testing.T) {
+	fileInfo, err := os.Stat("testdata/test.txt")
+	require.NoError(t, err)
+
+	info, err := Stat("testdata/test.txt")
+	require.NoError(t, err)
+	assert.Equal(t, fileInfo.Size(), info.Size)
+	assert.Equal(t, fileInfo.ModTime(), info.ModTime)
+	assert.Equal(t, fileInfo.Mode(), info.Mode)
+	assert.False(t, info.IsSymlink)
+	if runtime.GOOS != "windows" {
+		assert.NotZero(t, info.Inode)
+		assert.NotZero(t, info.Nlink)
+	}
+
+	_, err = Stat("testdata/wrong.txt")
+	assert.Error(t, err)
+}
+
+func TestStatSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on windows")
+	}
+	target, err := filepath.Abs("testdata/test.txt")
+	require.NoError(t, err)
+	link := filepath.Join(t.TempDir(), "link.txt")
+	require.NoError(t, os.Symlink(target, link))
+
+	info, err := Stat(link)
+	require.NoError(t, err)
+	assert.True(t, info.IsSymlink)
+}
@@ -0,0 +1,13 @@
+package fileutil
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/sevigo/notify/event"
+)
+
+func fillTimes(info *event.AdditionalInfo, stat *syscall.Stat_t) {
+	info.AccessTime = time.Unix(stat.Atim.Unix())
+	info.ChangeTime = time.Unix(stat.Ctim.Unix())
+}
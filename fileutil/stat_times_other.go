@@ -0,0 +1,12 @@
+//go:build !windows && !linux && !darwin
+
+package fileutil
+
+import (
+	"syscall"
+
+	"github.com/sevigo/notify/event"
+)
+
+// fillTimes is a no-op, the names of the time fields differ between the other platforms
+func fillTimes(_ *event.AdditionalInfo, _ *syscall.Stat_t) {}
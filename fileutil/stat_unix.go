@@ -0,0 +1,23 @@
+//go:build !windows
+
+package fileutil
+
+import (
+	"io/fs"
+	"syscall"
+
+	"github.com/sevigo/notify/event"
+)
+
+func fillSysInfo(info *event.AdditionalInfo, fileInfo fs.FileInfo) {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	info.UID = stat.Uid
+	info.GID = stat.Gid
+	info.Inode = uint64(stat.Ino)
+	info.Device = uint64(stat.Dev)
+	info.Nlink = uint64(stat.Nlink)
+	fillTimes(info, stat)
+}
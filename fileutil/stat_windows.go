@@ -0,0 +1,12 @@
+//go:build windows
+
+package fileutil
+
+import (
+	"io/fs"
+
+	"github.com/sevigo/notify/event"
+)
+
+// fillSysInfo is a no-op, windows has no owner, inode or link count in the file attributes
+func fillSysInfo(_ *event.AdditionalInfo, _ fs.FileInfo) {}
@@ -1,10 +1,11 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/sevigo/notify/core (interfaces: DirectoryWatcher)
+// Source: github.com/sevigo/notify/core (interfaces: DirectoryWatcher,Watch)
 
 // Package mocks is a generated GoMock package.
 package mocks
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/sevigo/notify/core"
 	event "github.com/sevigo/notify/event"
@@ -62,30 +63,31 @@ func (mr *MockDirectoryWatcherMockRecorder) Event() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Event", reflect.TypeOf((*MockDirectoryWatcher)(nil).Event))
 }
 
-// Scan mocks base method
-func (m *MockDirectoryWatcher) Scan(arg0 string) error {
+// RescanAll mocks base method
+func (m *MockDirectoryWatcher) RescanAll() {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Scan", arg0)
-	ret0, _ := ret[0].(error)
-	return ret0
+	m.ctrl.Call(m, "RescanAll")
 }
 
-// Scan indicates an expected call of Scan
-func (mr *MockDirectoryWatcherMockRecorder) Scan(arg0 interface{}) *gomock.Call {
+// RescanAll indicates an expected call of RescanAll
+func (mr *MockDirectoryWatcherMockRecorder) RescanAll() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scan", reflect.TypeOf((*MockDirectoryWatcher)(nil).Scan), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RescanAll", reflect.TypeOf((*MockDirectoryWatcher)(nil).RescanAll))
 }
 
 // StartWatching mocks base method
-func (m *MockDirectoryWatcher) StartWatching(arg0 string, arg1 *core.WatchingOptions) {
+func (m *MockDirectoryWatcher) StartWatching(arg0 context.Context, arg1 string, arg2 *core.WatchingOptions) (core.Watch, error) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "StartWatching", arg0, arg1)
+	ret := m.ctrl.Call(m, "StartWatching", arg0, arg1, arg2)
+	ret0, _ := ret[0].(core.Watch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // StartWatching indicates an expected call of StartWatching
-func (mr *MockDirectoryWatcherMockRecorder) StartWatching(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockDirectoryWatcherMockRecorder) StartWatching(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartWatching", reflect.TypeOf((*MockDirectoryWatcher)(nil).StartWatching), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartWatching", reflect.TypeOf((*MockDirectoryWatcher)(nil).StartWatching), arg0, arg1, arg2)
 }
 
 // StopWatching mocks base method
@@ -99,3 +101,94 @@ func (mr *MockDirectoryWatcherMockRecorder) StopWatching(arg0 interface{}) *gomo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopWatching", reflect.TypeOf((*MockDirectoryWatcher)(nil).StopWatching), arg0)
 }
+
+// MockWatch is a mock of Watch interface
+type MockWatch struct {
+	ctrl     *gomock.Controller
+	recorder *MockWatchMockRecorder
+}
+
+// MockWatchMockRecorder is the mock recorder for MockWatch
+type MockWatchMockRecorder struct {
+	mock *MockWatch
+}
+
+// NewMockWatch creates a new mock instance
+func NewMockWatch(ctrl *gomock.Controller) *MockWatch {
+	mock := &MockWatch{ctrl: ctrl}
+	mock.recorder = &MockWatchMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockWatch) EXPECT() *MockWatchMockRecorder {
+	return m.recorder
+}
+
+// Done mocks base method
+func (m *MockWatch) Done() <-chan struct{} {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Done")
+	ret0, _ := ret[0].(<-chan struct{})
+	return ret0
+}
+
+// Done indicates an expected call of Done
+func (mr *MockWatchMockRecorder) Done() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Done", reflect.TypeOf((*MockWatch)(nil).Done))
+}
+
+// Err mocks base method
+func (m *MockWatch) Err() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Err")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Err indicates an expected call of Err
+func (mr *MockWatchMockRecorder) Err() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Err", reflect.TypeOf((*MockWatch)(nil).Err))
+}
+
+// Options mocks base method
+func (m *MockWatch) Options() core.WatchingOptions {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Options")
+	ret0, _ := ret[0].(core.WatchingOptions)
+	return ret0
+}
+
+// Options indicates an expected call of Options
+func (mr *MockWatchMockRecorder) Options() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Options", reflect.TypeOf((*MockWatch)(nil).Options))
+}
+
+// Path mocks base method
+func (m *MockWatch) Path() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Path")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Path indicates an expected call of Path
+func (mr *MockWatchMockRecorder) Path() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Path", reflect.TypeOf((*MockWatch)(nil).Path))
+}
+
+// Stop mocks base method
+func (m *MockWatch) Stop() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Stop")
+}
+
+// Stop indicates an expected call of Stop
+func (mr *MockWatchMockRecorder) Stop() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockWatch)(nil).Stop))
+}
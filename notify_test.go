@@ -1,10 +1,11 @@
-// +build fake
+//go:build fake
 
 package notify
 
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -25,20 +26,34 @@ func TestSetup(t *testing.T) {
 			options: &watcher.Options{},
 			path:    "/foo/bar",
 			want: event.Event{
-				Action: event.FileAdded,
-				Path:   "/foo/bar/test.txt",
+				Action:       event.FileAdded,
+				Path:         "/foo/bar/test.txt",
+				Root:         "/foo/bar",
+				RelativePath: "test.txt",
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			fs := watcher.DefaultFakeFS()
+			assert.NoError(t, fs.MkdirAll(tt.path))
 			w := Setup(context.TODO(), tt.options)
-			go w.StartWatching(tt.path, &core.WatchingOptions{})
 			go func() {
-				<-w.Error()
+				for range w.Error() {
+				}
 			}()
+			watch, err := w.StartWatching(context.TODO(), tt.path, &core.WatchingOptions{})
+			assert.NoError(t, err)
+			assert.NoError(t, fs.Create(tt.path+"/test.txt", []byte("test")))
 			e := <-w.Event()
-			assert.Equal(t, e, tt.want)
+			assert.NotZero(t, e.Seq)
+			assert.False(t, e.DetectedAt.IsZero())
+			e.Seq = 0
+			e.DetectedAt = time.Time{}
+			assert.Equal(t, int64(4), e.Size)
+			e.AdditionalInfo = event.AdditionalInfo{}
+			assert.Equal(t, tt.want, e)
+			watch.Stop()
 		})
 	}
 }
@@ -0,0 +1,64 @@
+package notifytest
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/watcher"
+)
+
+var update = flag.Bool("notifytest.update", false, "write the golden files of notifytest.ExpectGolden")
+
+// FormatEvents returns a line for every event with its action and its path relative to the watched root,
+// e.g. "added dir/a.txt" or "renamedTo b.txt <- a.txt". The metadata is left out to keep the lines stable
+func FormatEvents(events []event.Event) string {
+	var b strings.Builder
+	for _, e := range events {
+		b.WriteString(watcher.ActionToString(e.Action))
+		b.WriteString(" ")
+		b.WriteString(filepath.ToSlash(e.RelativePath))
+		if e.OldName != "" {
+			b.WriteString(" <- ")
+			b.WriteString(filepath.ToSlash(relativeOldName(e)))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// ExpectGolden compares the formatted events with a golden file, it's written instead
+// if the tests run with -notifytest.update. The events with the same deadline of the
+// debouncing are sent in any order, they must be sorted before they are compared
+func ExpectGolden(t testing.TB, golden string, events []event.Event) {
+	t.Helper()
+	got := FormatEvents(events)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatalf("can't write the golden file [%s]: %v", golden, err)
+		}
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatalf("can't write the golden file [%s]: %v", golden, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("can't read the golden file [%s], run the test with -notifytest.update to write it: %v", golden, err)
+	}
+	if got != string(want) {
+		t.Errorf("the events don't match the golden file [%s]\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
+
+// relativeOldName returns the old name relative to the watched root if it's inside of it
+func relativeOldName(e event.Event) string {
+	rel, err := filepath.Rel(e.Root, e.OldName)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return e.OldName
+	}
+	return rel
+}
@@ -0,0 +1,140 @@
+package notifytest
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/watcher"
+)
+
+// Matcher describes an expected event
+type Matcher interface {
+	Match(e event.Event) bool
+	String() string
+}
+
+type funcMatcher struct {
+	desc string
+	fn   func(e event.Event) bool
+}
+
+func (m funcMatcher) Match(e event.Event) bool {
+	return m.fn(e)
+}
+
+func (m funcMatcher) String() string {
+	return m.desc
+}
+
+// Func matches the events accepted by fn, desc describes them in the failures
+func Func(desc string, fn func(e event.Event) bool) Matcher {
+	return funcMatcher{desc: desc, fn: fn}
+}
+
+// Path matches the events of a path, either the absolute path or the one relative to the watched root
+func Path(path string) Matcher {
+	path = filepath.FromSlash(path)
+	return Func("path "+path, func(e event.Event) bool {
+		return e.Path == path || e.RelativePath == path
+	})
+}
+
+// OldName matches the renames from a path, either the absolute path or the one relative to the watched root
+func OldName(path string) Matcher {
+	path = filepath.FromSlash(path)
+	return Func("old name "+path, func(e event.Event) bool {
+		return e.OldName != "" && (e.OldName == path || relativeOldName(e) == path)
+	})
+}
+
+// Action matches the events of an action
+func Action(action event.ActionType) Matcher {
+	return Func("action "+watcher.ActionToString(action), func(e event.Event) bool {
+		return e.Action == action
+	})
+}
+
+// Event matches the events of an action for a path, it's the same as All(Action(action), Path(path))
+func Event(action event.ActionType, path string) Matcher {
+	return All(Action(action), Path(path))
+}
+
+// All matches the events which are matched by all matchers
+func All(matchers ...Matcher) Matcher {
+	descs := make([]string, len(matchers))
+	for i, m := range matchers {
+		descs[i] = m.String()
+	}
+	return Func(strings.Join(descs, " and "), func(e event.Event) bool {
+		for _, m := range matchers {
+			if !m.Match(e) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// inOrder is a sequence of matchers, it's resolved by ExpectEvents
+type inOrder []Matcher
+
+// InOrder expects the events of the matchers in their order, other events may come in between.
+// As a single matcher it matches the events which are matched by any of them
+func InOrder(matchers ...Matcher) Matcher {
+	return inOrder(matchers)
+}
+
+func (m inOrder) Match(e event.Event) bool {
+	for _, matcher := range m {
+		if matcher.Match(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m inOrder) String() string {
+	descs := make([]string, len(m))
+	for i, matcher := range m {
+		descs[i] = matcher.String()
+	}
+	return fmt.Sprintf("in order [%s]", strings.Join(descs, ", "))
+}
+
+// match assigns every matcher to the first event which is not used yet, it returns
+// the indices of the matched events and the descriptions of the missing matchers
+func match(events []event.Event, expected []bool, matchers []Matcher) ([]int, []string) {
+	used := append([]bool(nil), expected...)
+	var indices []int
+	var missing []string
+	find := func(m Matcher, from int) int {
+		for i := from; i < len(events); i++ {
+			if !used[i] && m.Match(events[i]) {
+				used[i] = true
+				indices = append(indices, i)
+				return i
+			}
+		}
+		missing = append(missing, m.String())
+		return -1
+	}
+
+	for _, m := range matchers {
+		sequence, ok := m.(inOrder)
+		if !ok {
+			find(m, 0)
+			continue
+		}
+		from := 0
+		for _, m := range sequence {
+			i := find(m, from)
+			if i < 0 {
+				break
+			}
+			from = i + 1
+		}
+	}
+	return indices, missing
+}
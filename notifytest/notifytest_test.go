@@ -0,0 +1,148 @@
+package notifytest_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sevigo/notify"
+	"github.com/sevigo/notify/clock"
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/notifytest"
+	"github.com/sevigo/notify/watcher"
+)
+
+// failingT records the failures of the helpers, Fatalf ends the goroutine like it ends a test
+type failingT struct {
+	testing.TB
+	failures []string
+}
+
+func (t *failingT) Helper() {}
+
+func (t *failingT) Errorf(format string, args ...interface{}) {
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+func (t *failingT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// flagUpdate returns true if the golden files are written instead of compared
+func flagUpdate() bool {
+	f := flag.Lookup("notifytest.update")
+	return f != nil && f.Value.String() == "true"
+}
+
+// run calls fn with a failingT in its own goroutine and returns the failures
+func run(fn func(t *failingT)) []string {
+	t := &failingT{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(t)
+	}()
+	<-done
+	return t.failures
+}
+
+func TestEventRecorder(t *testing.T) {
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	fs := watcher.NewFakeFS("notifytest", c)
+	root := filepath.FromSlash("/data")
+	require.NoError(t, fs.MkdirAll(root))
+
+	directoryWatcher := notify.Setup(context.TODO(), nil)
+	rec := notifytest.NewEventRecorder(directoryWatcher)
+	defer rec.Stop()
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:   "notifytest",
+		Recursive: true,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// the debouncing of a change ends when the clock is advanced, the events of the
+	// changes are expected one after the other to keep their order for the golden file
+	change := func(fn func() error, matchers ...notifytest.Matcher) event.Event {
+		t.Helper()
+		require.NoError(t, fn())
+		c.BlockUntil(1)
+		c.Advance(time.Second)
+		return rec.ExpectEvents(t, 5*time.Second, matchers...)[0]
+	}
+	e := change(func() error { return fs.Create(filepath.Join(root, "a.txt"), []byte("a")) },
+		notifytest.Event(event.FileAdded, "a.txt"))
+	assert.Equal(t, int64(1), e.Size)
+	// the modifications of the new file are merged with it
+	rec.ExpectNoEvents(t, 0)
+
+	change(func() error { return fs.Mkdir(filepath.Join(root, "dir")) },
+		notifytest.All(notifytest.Action(event.DirAdded), notifytest.Path(filepath.Join(root, "dir"))))
+	change(func() error { return fs.Rename(filepath.Join(root, "a.txt"), filepath.Join(root, "dir", "b.txt")) },
+		notifytest.All(notifytest.Event(event.FileRenamedNewName, "dir/b.txt"), notifytest.OldName("a.txt")))
+	change(func() error { return fs.Remove(filepath.Join(root, "dir", "b.txt")) },
+		notifytest.Event(event.FileRemoved, "dir/b.txt"))
+	rec.ExpectNoEvents(t, 0)
+	// the debug messages of the watch are recorded with the errors
+	for _, e := range rec.Errors() {
+		assert.NotEqual(t, event.ERROR.String(), e.Level, e.Message)
+	}
+
+	notifytest.ExpectGolden(t, filepath.Join("testdata", "recorder.golden"), rec.Events())
+}
+
+func TestExpectFailures(t *testing.T) {
+	var rec notifytest.EventRecorder
+	rec.HandleEvent(event.Event{Action: event.FileAdded, Path: "/data/a.txt", Root: "/data", RelativePath: "a.txt"})
+	rec.HandleEvent(event.Event{Action: event.FileRemoved, Path: "/data/a.txt", Root: "/data", RelativePath: "a.txt"})
+
+	// the order of the events is checked
+	events := rec.ExpectEvents(t, time.Second, notifytest.InOrder(
+		notifytest.Action(event.FileAdded),
+		notifytest.Action(event.FileRemoved),
+	))
+	assert.Len(t, events, 2)
+	rec.Reset()
+	rec.HandleEvent(event.Event{Action: event.FileAdded, Path: "/data/a.txt", Root: "/data", RelativePath: "a.txt"})
+	rec.HandleEvent(event.Event{Action: event.FileRemoved, Path: "/data/a.txt", Root: "/data", RelativePath: "a.txt"})
+	failures := run(func(t *failingT) {
+		rec.ExpectEvents(t, 10*time.Millisecond, notifytest.InOrder(
+			notifytest.Action(event.FileRemoved),
+			notifytest.Action(event.FileAdded),
+		))
+	})
+	require.Len(t, failures, 1)
+	assert.True(t, strings.HasPrefix(failures[0], "no events within 10ms for: action added\npending events:\nadded a.txt\nremoved a.txt\n"), failures[0])
+
+	// the events which were not expected are reported
+	rec.ExpectEvents(t, time.Second, notifytest.Event(event.FileAdded, "a.txt"))
+	failures = run(func(t *failingT) {
+		rec.ExpectNoEvents(t, 0)
+	})
+	assert.Equal(t, []string{"unexpected events:\nremoved a.txt\n"}, failures)
+
+	golden := filepath.Join(t.TempDir(), "events.golden")
+	require.NoError(t, os.WriteFile(golden, []byte("added a.txt\n"), 0o600))
+	failures = run(func(t *failingT) {
+		notifytest.ExpectGolden(t, golden, rec.Events())
+	})
+	if !flagUpdate() {
+		assert.Equal(t, []string{"the events don't match the golden file [" + golden + "]\ngot:\nadded a.txt\nremoved a.txt\n\nwant:\nadded a.txt\n"}, failures)
+	}
+
+	rec.Reset()
+	assert.Empty(t, rec.Events())
+	rec.ExpectNoEvents(t, 10*time.Millisecond)
+}
@@ -0,0 +1,192 @@
+/*
+Package notifytest provides the helpers to test the code which uses a watcher.
+
+An EventRecorder drains the events and errors of a watcher, ExpectEvents waits until
+the events described by the matchers are recorded and ExpectNoEvents checks that nothing
+else is reported. ExpectGolden compares a sequence of events with a golden file, the
+files are written by running the tests with -notifytest.update.
+
+With the FakeFS backend of the watcher package and a clock.Fake the tests run without
+a real file system and without sleeping.
+*/
+package notifytest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+)
+
+// EventRecorder records the events and errors of a watcher. The zero value records
+// the events and errors passed to HandleEvent and HandleError, e.g. as the handlers
+// of the WatchingOptions of a single watch
+type EventRecorder struct {
+	mu     sync.Mutex
+	events []event.Event
+	// expected marks the events which were matched by ExpectEvents
+	expected []bool
+	errors   []event.Error
+	// changed is closed when an event is recorded
+	changed chan struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewEventRecorder drains the shared Event() and Error() channels of the watcher until Stop is called
+func NewEventRecorder(w core.DirectoryWatcher) *EventRecorder {
+	r := &EventRecorder{stop: make(chan struct{})}
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case e := <-w.Event():
+				r.HandleEvent(e)
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case e := <-w.Error():
+				r.HandleError(e)
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// Stop ends the draining of the watcher, the recorded events are kept
+func (r *EventRecorder) Stop() {
+	if r.stop == nil {
+		return
+	}
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	r.wg.Wait()
+}
+
+// HandleEvent records an event
+func (r *EventRecorder) HandleEvent(e event.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	r.expected = append(r.expected, false)
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+}
+
+// HandleError records an error
+func (r *EventRecorder) HandleError(e event.Error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, e)
+}
+
+// Events returns all recorded events in the order they were received
+func (r *EventRecorder) Events() []event.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]event.Event(nil), r.events...)
+}
+
+// Errors returns all recorded errors
+func (r *EventRecorder) Errors() []event.Error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]event.Error(nil), r.errors...)
+}
+
+// Reset drops the recorded events and errors
+func (r *EventRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events, r.expected, r.errors = nil, nil, nil
+}
+
+// ExpectEvents waits until an event is recorded for every matcher and returns them in the order of the matchers.
+// Every matcher is matched with the first event which is not matched yet, the events of InOrder follow each
+// other. The test fails if they are not recorded within the timeout. The matched events are not checked by
+// ExpectNoEvents, the others are still pending
+func (r *EventRecorder) ExpectEvents(t testing.TB, timeout time.Duration, matchers ...Matcher) []event.Event {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		r.mu.Lock()
+		indices, missing := match(r.events, r.expected, matchers)
+		if len(missing) == 0 {
+			events := make([]event.Event, len(indices))
+			for i, index := range indices {
+				r.expected[index] = true
+				events[i] = r.events[index]
+			}
+			r.mu.Unlock()
+			return events
+		}
+		changed := r.changedChan()
+		r.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("no events within %v for: %s\npending events:\n%s", timeout, strings.Join(missing, ", "), FormatEvents(r.pending()))
+			return nil
+		}
+	}
+}
+
+// ExpectNoEvents fails the test if an event which was not matched by ExpectEvents is recorded within the duration
+func (r *EventRecorder) ExpectNoEvents(t testing.TB, d time.Duration) {
+	t.Helper()
+	deadline := time.After(d)
+	for {
+		r.mu.Lock()
+		changed := r.changedChan()
+		r.mu.Unlock()
+		if pending := r.pending(); len(pending) > 0 {
+			t.Errorf("unexpected events:\n%s", FormatEvents(pending))
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// pending returns the events which were not matched by ExpectEvents
+func (r *EventRecorder) pending() []event.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []event.Event
+	for i, e := range r.events {
+		if !r.expected[i] {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// changedChan must be called with the mutex held
+func (r *EventRecorder) changedChan() chan struct{} {
+	if r.changed == nil {
+		r.changed = make(chan struct{})
+	}
+	return r.changed
+}
@@ -0,0 +1,116 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
+)
+
+// attributeCache remembers the last known metadata of the files of a watch,
+// it's used to report which attributes were changed
+type attributeCache struct {
+	mu    sync.Mutex
+	files map[string]event.AdditionalInfo
+}
+
+// changes returns the changed attributes of the file and remembers the new ones
+func (c *attributeCache) changes(path string, info *event.AdditionalInfo) event.Attribute {
+	if info == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous, ok := c.files[path]
+	if !ok {
+		return 0
+	}
+	return info.Changes(previous)
+}
+
+// update remembers the metadata of the file after an event
+func (c *attributeCache) update(path string, action event.ActionType, info *event.AdditionalInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files == nil {
+		c.files = make(map[string]event.AdditionalInfo)
+	}
+	switch action {
+	case event.FileRemoved, event.FileRenamedOldName:
+		delete(c.files, path)
+		return
+	case event.DirRemoved:
+		for file := range c.files {
+			if isSubPath(path, file) {
+				delete(c.files, file)
+			}
+		}
+		return
+	case event.FileRenamedNewName:
+		if info != nil {
+			delete(c.files, info.OldName)
+		}
+	case event.DirRenamed:
+		if info != nil {
+			for file, fileInfo := range c.files {
+				if isSubPath(info.OldName, file) {
+					delete(c.files, file)
+					c.files[path+file[len(info.OldName):]] = fileInfo
+				}
+			}
+		}
+	}
+	if info != nil && !info.ModTime.IsZero() {
+		c.files[path] = *info
+	}
+}
+
+// has returns true if the metadata of the file is known
+func (c *attributeCache) has(path string) bool {
+	_, ok := c.lookup(path)
+	return ok
+}
+
+// lookup returns the remembered metadata of the file
+func (c *attributeCache) lookup(path string) (event.AdditionalInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, ok := c.files[path]
+	return info, ok
+}
+
+// snapshotFile remembers the metadata of a single file
+func (c *attributeCache) snapshotFile(path string) {
+	if info, err := fileutil.Stat(path); err == nil {
+		c.update(path, event.FileAdded, info)
+	}
+}
+
+// snapshot remembers the metadata of all entries of the directory
+func (c *attributeCache) snapshot(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		fileInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		info := fileutil.Info(fileInfo)
+		c.update(filepath.Join(dir, entry.Name()), event.FileAdded, &info)
+	}
+}
+
+// known returns a copy of the remembered metadata
+func (c *attributeCache) known() map[string]event.AdditionalInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files := make(map[string]event.AdditionalInfo, len(c.files))
+	for path, info := range c.files {
+		files[path] = info
+	}
+	return files
+}
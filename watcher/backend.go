@@ -0,0 +1,358 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/sevigo/notify/clock"
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+)
+
+// Backend is a source of file system notifications. The built-in backends register
+// themselves, others are added with RegisterBackend. A backend is selected by its name
+// with the Backend of the Options or of the WatchingOptions. The changes are reported
+// as they happen, the watches which use a backend debounce them
+type Backend interface {
+	// Add starts watching a path, its changes are sent to Events until it's removed.
+	// StartWatching returns its error unchanged, it should name the path
+	Add(path string, options core.WatchingOptions) error
+	// Remove stops watching a path
+	Remove(path string) error
+	// Events returns the changes of all watched paths
+	Events() <-chan BackendEvent
+	// Close stops watching all paths and closes the Events channel
+	Close() error
+}
+
+// BackendEvent is a change reported by a backend
+type BackendEvent struct {
+	// Root is the path passed to Add
+	Root   string
+	Path   string
+	Action event.ActionType
+	// Info is read from the file system if it's not provided by the backend
+	Info    *event.AdditionalInfo
+	Process *event.Process
+	// ChangedAttributes is set for FileAttributesChanged if the backend knows the previous attributes
+	ChangedAttributes event.Attribute
+	// Raw is the backend specific record, it's added to the event in the raw mode.
+	// The records of a change reported with several of them are passed as []interface{}
+	Raw interface{}
+	// Message is a debug message, a warning or an error of the watch of the Root which doesn't end it
+	Message *event.Error
+	// Err is set if the watch of the Root has ended because of an error, e.g. ErrRootLost
+	Err error
+}
+
+// BackendFactory creates a new instance of a backend, every watch gets its own instance
+type BackendFactory func() (Backend, error)
+
+var backendsMutex sync.Mutex
+var backends = make(map[string]BackendFactory)
+
+// RegisterBackend adds a backend which can be selected by its name, a built-in backend
+// with the same name is replaced
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	backends[name] = factory
+	delete(fileSystems, name)
+}
+
+// registerBuiltinBackend adds a backend which runs the watches with the start function
+func registerBuiltinBackend(name string, start func(w *DirectoryWatcher, wt *watch) error) {
+	RegisterBackend(name, func() (Backend, error) {
+		return newBuiltinBackend(start), nil
+	})
+}
+
+// Backends returns the names of all registered backends
+func Backends() []string {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewBackend creates an instance of a registered backend
+func NewBackend(name string) (Backend, error) {
+	backendsMutex.Lock()
+	factory, ok := backends[name]
+	backendsMutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q", name)
+	}
+	return factory()
+}
+
+// backendName returns the backend of a watch, the options of the watch are preferred
+// over the global options and the default backend of the OS
+func (w *DirectoryWatcher) backendName(options core.WatchingOptions) string {
+	switch {
+	case options.Backend != "":
+		return options.Backend
+	case w.backend != "":
+		return w.backend
+	}
+	return defaultBackend
+}
+
+// attacher is implemented by the built-in backends, attach is called before a watch of the
+// DirectoryWatcher is added. The backend shares the poll budget of the DirectoryWatcher and
+// passes the changes to the watch directly, it sets its own clock if the watch selects none
+type attacher interface {
+	attach(w *DirectoryWatcher, wt *watch)
+}
+
+// start starts the backend selected by the options of the watch, its events are
+// passed through the debouncing of the watch
+func (w *DirectoryWatcher) start(wt *watch) error {
+	b, err := NewBackend(w.backendName(wt.options))
+	if err != nil {
+		return fmt.Errorf("cannot start watching [%s]: %v", wt.path, err)
+	}
+	if a, ok := b.(attacher); ok {
+		a.attach(w, wt)
+	}
+	options := wt.options
+	options.Clock = wt.clock
+	if err := b.Add(wt.path, options); err != nil {
+		b.Close()
+		return err
+	}
+
+	go func() {
+		defer b.Close()
+		for {
+			select {
+			case e, ok := <-b.Events():
+				if !ok {
+					wt.finish(nil)
+					return
+				}
+				if !wt.backendEvent(e) {
+					return
+				}
+			case <-wt.stopped():
+				// the backend is released before the watch is done
+				b.Close()
+				wt.finish(nil)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// backendEvent passes an event of the backend of the watch on, it returns false if the watch has ended
+func (wt *watch) backendEvent(e BackendEvent) bool {
+	var raw []interface{}
+	switch r := e.Raw.(type) {
+	case nil:
+	case []interface{}:
+		raw = r
+	default:
+		raw = []interface{}{r}
+	}
+	switch {
+	case e.Err != nil:
+		wt.finish(e.Err)
+		return false
+	case e.Message != nil:
+		wt.sendError(*e.Message)
+	case e.Action == event.WatchRootLost:
+		wt.rootLost(raw...)
+	default:
+		wt.notifyChange(e, raw)
+	}
+	return true
+}
+
+// emit sends a change of a watch run by a Backend, the metadata and the changed attributes
+// are read like for the debounced events, the symlinks are resolved by the consumer if any
+func (wt *watch) emit(e BackendEvent, raw []interface{}) {
+	if wt.isIgnoredSymlink(e.Path) {
+		return
+	}
+	if wt.consumer == nil {
+		wt.symlinkChanged(e.Path, e.Action)
+	}
+	e.Root = wt.path
+	e.Info = metadata(e.Path, e.Action, e.Info)
+	if e.Action == event.FileAttributesChanged {
+		e.ChangedAttributes = wt.attributes.changes(e.Path, e.Info)
+	}
+	wt.attributes.update(e.Path, e.Action, e.Info)
+	e.Raw = rawRecord(raw)
+	wt.output(e)
+}
+
+// builtinBackend is the Backend of a built-in backend, every path is watched by a watch which
+// is run by the start function of the backend and reports its changes to the backend
+type builtinBackend struct {
+	start func(w *DirectoryWatcher, wt *watch) error
+	// clock is used by the watches which select none, e.g. the clock of a FakeFS
+	clock clock.Clock
+	// fs is the file system of the watches if the backend models its own
+	fs fileSystem
+	// watcher and consumer are set by attach, the changes are passed to the consumer directly
+	watcher  *DirectoryWatcher
+	consumer *watch
+
+	events chan BackendEvent
+	closed chan struct{}
+	// sending is held while an event is sent, Close waits for it before closing the events
+	sending sync.RWMutex
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	watches map[string]*watch
+}
+
+func newBuiltinBackend(start func(w *DirectoryWatcher, wt *watch) error) *builtinBackend {
+	return &builtinBackend{
+		start:   start,
+		events:  make(chan BackendEvent),
+		closed:  make(chan struct{}),
+		watches: make(map[string]*watch),
+	}
+}
+
+func (b *builtinBackend) attach(w *DirectoryWatcher, wt *watch) {
+	b.watcher, b.consumer = w, wt
+	if b.clock != nil && wt.options.Clock == nil {
+		wt.clock = b.clock
+		wt.waiter.Clock = b.clock
+	}
+}
+
+// errBackendClosed is returned by Add after the backend was closed
+var errBackendClosed = errors.New("the backend is closed")
+
+func (b *builtinBackend) Add(path string, options core.WatchingOptions) error {
+	path = filepath.Clean(path)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.closed:
+		return errBackendClosed
+	default:
+	}
+	if _, ok := b.watches[path]; ok {
+		return fmt.Errorf("[%s] is already watched", path)
+	}
+
+	// the output of the watch is the backend
+	options.EventCh, options.ErrorCh = nil, nil
+	options.EventHandler, options.ErrorHandler = nil, nil
+	wt := newWatch(context.Background(), path, &options)
+	if options.Clock == nil && b.clock != nil {
+		wt.clock = b.clock
+	}
+	wt.output = b.send
+	w := b.watcher
+	if w == nil {
+		w = &DirectoryWatcher{}
+	} else {
+		wt.polls = w.polls
+	}
+	if b.consumer != nil && b.consumer.path == path {
+		wt.consumer = b.consumer
+	}
+	if b.fs != nil {
+		wt.fs = b.fs
+	}
+	wt.detectFile()
+	if err := b.start(w, wt); err != nil {
+		return err
+	}
+	if options.ResolveSymlinks && wt.consumer == nil {
+		wt.resolveSymlinks()
+	}
+	b.watches[path] = wt
+	b.wg.Add(1)
+	go b.wait(wt)
+	return nil
+}
+
+// wait reports the error of a watch when it has ended
+func (b *builtinBackend) wait(wt *watch) {
+	defer b.wg.Done()
+	<-wt.done
+	if err := wt.Err(); err != nil {
+		b.send(BackendEvent{Root: wt.path, Err: err})
+	}
+}
+
+// rawRecord returns the single record of a raw event, the records of a merged event as a slice
+func rawRecord(raw []interface{}) interface{} {
+	switch len(raw) {
+	case 0:
+		return nil
+	case 1:
+		return raw[0]
+	}
+	return raw
+}
+
+// send passes an event to the consumer or sends it to the events until the backend is closed
+func (b *builtinBackend) send(e BackendEvent) {
+	if b.consumer != nil {
+		b.consumer.backendEvent(e)
+		return
+	}
+	b.sending.RLock()
+	defer b.sending.RUnlock()
+	select {
+	case b.events <- e:
+	case <-b.closed:
+	}
+}
+
+func (b *builtinBackend) Remove(path string) error {
+	path = filepath.Clean(path)
+	b.mu.Lock()
+	wt, ok := b.watches[path]
+	delete(b.watches, path)
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("[%s] is not watched", path)
+	}
+	wt.cancel()
+	return nil
+}
+
+func (b *builtinBackend) Events() <-chan BackendEvent {
+	return b.events
+}
+
+func (b *builtinBackend) Close() error {
+	b.mu.Lock()
+	select {
+	case <-b.closed:
+		b.mu.Unlock()
+		return nil
+	default:
+	}
+	close(b.closed)
+	for path, wt := range b.watches {
+		wt.cancel()
+		delete(b.watches, path)
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	b.sending.Lock()
+	close(b.events)
+	b.sending.Unlock()
+	return nil
+}
@@ -0,0 +1,104 @@
+package watcher_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sevigo/notify/clock"
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/watcher"
+)
+
+// testBackend reports the events sent to its channel
+type testBackend struct {
+	events chan watcher.BackendEvent
+	closed chan struct{}
+}
+
+func (b *testBackend) Add(string, core.WatchingOptions) error { return nil }
+func (b *testBackend) Remove(string) error                    { return nil }
+func (b *testBackend) Events() <-chan watcher.BackendEvent    { return b.events }
+func (b *testBackend) Close() error                           { close(b.closed); return nil }
+
+func TestRegisterBackend(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	b := &testBackend{events: make(chan watcher.BackendEvent), closed: make(chan struct{})}
+	watcher.RegisterBackend("test", func() (watcher.Backend, error) {
+		return b, nil
+	})
+	assert.Contains(t, watcher.Backends(), "test")
+	assert.Contains(t, watcher.Backends(), "poll")
+
+	_, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{Backend: "unknown"})
+	assert.EqualError(t, err, `cannot start watching [`+root+`]: unknown backend "unknown"`)
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:      "test",
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// the events of the backend are debounced like the ones of the built-in backends,
+	// the event of the other file is received once the modification is merged
+	path := filepath.Join(root, "test.txt")
+	b.events <- watcher.BackendEvent{Root: root, Path: path, Action: event.FileAdded}
+	b.events <- watcher.BackendEvent{Root: root, Path: path, Action: event.FileModified}
+	b.events <- watcher.BackendEvent{Root: root, Path: filepath.Join(root, "other.txt"), Action: event.FileAdded}
+	c.BlockUntil(2)
+	c.Advance(time.Second)
+	events := collectEvents(t, eventCh, 2)
+	assert.Equal(t, event.FileAdded, events["test.txt"].Action)
+	assert.Equal(t, root, events["test.txt"].Root)
+	assert.Equal(t, event.FileAdded, events["other.txt"].Action)
+
+	// an error of the backend ends the watch
+	errTest := errors.New("test error")
+	b.events <- watcher.BackendEvent{Root: root, Err: errTest}
+	<-w.Done()
+	assert.Equal(t, errTest, w.Err())
+	<-b.closed
+}
+
+func TestBuiltinBackend(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	b, err := watcher.NewBackend("poll")
+	require.NoError(t, err)
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, b.Add(root, core.WatchingOptions{PollInterval: time.Second, Clock: c}))
+
+	// the changes are reported by the next poll without debouncing
+	require.NoError(t, os.WriteFile(filepath.Join(root, "test.txt"), []byte("test"), 0o600))
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	var e watcher.BackendEvent
+	for e.Action == event.Invalid {
+		e = <-b.Events()
+		// the messages of the watch are passed on as well
+		require.True(t, e.Message != nil || e.Action != event.Invalid)
+	}
+	assert.Equal(t, root, e.Root)
+	assert.Equal(t, filepath.Join(root, "test.txt"), e.Path)
+	assert.Equal(t, event.FileAdded, e.Action)
+	require.NotNil(t, e.Info)
+	assert.Equal(t, int64(4), e.Info.Size)
+
+	require.NoError(t, b.Remove(root))
+	require.NoError(t, b.Close())
+	_, ok := <-b.Events()
+	assert.False(t, ok)
+}
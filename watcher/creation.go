@@ -0,0 +1,85 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// creationPollInterval is how often the root is checked while waiting for it,
+// in case the creation was missed or the ancestor can't be watched
+const creationPollInterval = time.Second
+
+// waitForRoot blocks until the root of the watch exists, the nearest existing
+// ancestor is watched to notice the creation of the next path element.
+// It returns false if the watch was stopped in the meantime
+func (wt *watch) waitForRoot() bool {
+	ancestors, err := fsnotify.NewWatcher()
+	if err != nil {
+		wt.fileDebug("DEBUG", fmt.Sprintf("can't watch the ancestors of [%s]: %v", wt.path, err))
+	} else {
+		defer ancestors.Close()
+	}
+
+	ticker := wt.clock.NewTicker(creationPollInterval)
+	defer ticker.Stop()
+	var watched string
+	for {
+		if _, err := os.Stat(wt.path); err == nil {
+			return true
+		}
+		if ancestors != nil {
+			if ancestor := nearestAncestor(wt.path); ancestor != watched {
+				if watched != "" {
+					_ = ancestors.Remove(watched)
+				}
+				watched = ""
+				if err := ancestors.Add(ancestor); err == nil {
+					watched = ancestor
+					wt.fileDebug("DEBUG", fmt.Sprintf("waiting for [%s] in [%s]", wt.path, ancestor))
+					// the next path element could have been created before the ancestor was added
+					continue
+				}
+			}
+		}
+
+		select {
+		case <-ancestorEvents(ancestors):
+		case <-ancestorErrors(ancestors):
+		case <-ticker.C():
+		case <-wt.stopped():
+			return false
+		}
+	}
+}
+
+// nearestAncestor returns the closest parent of the path which exists
+func nearestAncestor(path string) string {
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return parent
+		}
+		if info, err := os.Stat(parent); err == nil && info.IsDir() {
+			return parent
+		}
+		path = parent
+	}
+}
+
+func ancestorEvents(w *fsnotify.Watcher) chan fsnotify.Event {
+	if w == nil {
+		return nil
+	}
+	return w.Events
+}
+
+func ancestorErrors(w *fsnotify.Watcher) chan error {
+	if w == nil {
+		return nil
+	}
+	return w.Errors
+}
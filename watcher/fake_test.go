@@ -0,0 +1,37 @@
+//go:build fake
+// +build fake
+
+package watcher_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/watcher"
+)
+
+func TestDefaultFakeFS(t *testing.T) {
+	fs := watcher.DefaultFakeFS()
+	root := filepath.FromSlash("/default")
+	require.NoError(t, fs.MkdirAll(root))
+
+	// the watches use the fake backend without selecting it
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	require.NoError(t, fs.Create(filepath.Join(root, "a.txt"), []byte("a")))
+	e := collectEvents(t, eventCh, 1)["a.txt"]
+	assert.Equal(t, event.FileAdded, e.Action)
+	assert.Equal(t, int64(1), e.Size)
+}
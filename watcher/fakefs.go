@@ -0,0 +1,644 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sevigo/notify/clock"
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
+)
+
+// FakeFS is an in-memory file system for tests. It's the backend registered by NewFakeFS,
+// its changes are reported like inotify reports them, e.g. a new file is added and modified
+// twice, and they pass the same debouncing and filtering as the changes of the real backends.
+// The changes are reported before the methods return, the debouncing runs on the clock of the
+// file system, with a clock.Fake the events are sent when the clock is advanced
+type FakeFS struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	nodes   map[string]*fakeNode
+	inodes  uint64
+	watches map[*watch]*fakeWatch
+	// changed is closed and replaced by every change, it wakes the watches waiting for their root
+	changed chan struct{}
+}
+
+type fakeNode struct {
+	dir  bool
+	data []byte
+	info event.AdditionalInfo
+}
+
+// fakeWatch is a watch of the fake backend, lost is closed when the lost root is reported
+type fakeWatch struct {
+	wt   *watch
+	lost chan struct{}
+}
+
+// fakeChange is a change of the model, oldPath is set for a rename
+type fakeChange struct {
+	path    string
+	oldPath string
+	dir     bool
+	action  event.ActionType
+	op      string
+}
+
+// NewFakeFS creates an empty file system and registers it as a backend with the name,
+// the real clock is used if c is nil
+func NewFakeFS(name string, c clock.Clock) *FakeFS {
+	if c == nil {
+		c = clock.Real
+	}
+	fs := &FakeFS{
+		clock:   c,
+		nodes:   make(map[string]*fakeNode),
+		watches: make(map[*watch]*fakeWatch),
+		changed: make(chan struct{}),
+	}
+	RegisterBackend(name, func() (Backend, error) {
+		b := newBuiltinBackend(fs.start)
+		b.clock = fs.clock
+		b.fs = fs
+		return b, nil
+	})
+	registerFileSystem(name, fs)
+	return fs
+}
+
+func (fs *FakeFS) start(_ *DirectoryWatcher, wt *watch) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	root, ok := fs.lookup(wt.path)
+	if !ok {
+		return fmt.Errorf("cannot start watching [%s]: %v", wt.path, &os.PathError{Op: "stat", Path: wt.path, Err: syscall.ENOENT})
+	}
+	wt.file = !root.dir
+	for path := range fs.nodes {
+		if fs.covers(wt, path) {
+			info := fs.info(path)
+			wt.attributes.update(path, event.FileAdded, info)
+		}
+	}
+	fs.watches[wt] = &fakeWatch{wt: wt}
+
+	go func() {
+		<-wt.stopped()
+		fs.mu.Lock()
+		delete(fs.watches, wt)
+		fs.mu.Unlock()
+		wt.finish(nil)
+	}()
+	return nil
+}
+
+// Mkdir creates a directory, its parent must exist
+func (fs *FakeFS) Mkdir(path string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path = filepath.Clean(path)
+	if err := fs.checkNew("mkdir", path); err != nil {
+		return err
+	}
+	fs.add(path, true, nil)
+	fs.report(fakeChange{path: path, dir: true, action: event.DirAdded, op: "mkdir"})
+	return nil
+}
+
+// MkdirAll creates a directory and all of its missing parents
+func (fs *FakeFS) MkdirAll(path string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path = filepath.Clean(path)
+	var missing []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if node, ok := fs.lookup(dir); ok {
+			if !node.dir {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		missing = append(missing, dir)
+	}
+	var changes []fakeChange
+	for i := len(missing) - 1; i >= 0; i-- {
+		fs.add(missing[i], true, nil)
+		changes = append(changes, fakeChange{path: missing[i], dir: true, action: event.DirAdded, op: "mkdir"})
+	}
+	fs.report(changes...)
+	return nil
+}
+
+// Create creates a file with the data or replaces the data of an existing file,
+// like a write after opening the file with O_CREATE|O_TRUNC and closing it
+func (fs *FakeFS) Create(path string, data []byte) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path = filepath.Clean(path)
+	if node, ok := fs.nodes[path]; ok {
+		if node.dir {
+			return &os.PathError{Op: "open", Path: path, Err: syscall.EISDIR}
+		}
+		fs.write(node, data)
+		fs.report(fs.writeChanges(path, data)...)
+		return nil
+	}
+	if err := fs.checkNew("open", path); err != nil {
+		return err
+	}
+	fs.add(path, false, data)
+	changes := append([]fakeChange{{path: path, action: event.FileAdded, op: "create"}}, fs.writeChanges(path, data)...)
+	fs.report(changes...)
+	return nil
+}
+
+// Write replaces the data of an existing file
+func (fs *FakeFS) Write(path string, data []byte) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path = filepath.Clean(path)
+	node, ok := fs.nodes[path]
+	switch {
+	case !ok:
+		return &os.PathError{Op: "open", Path: path, Err: syscall.ENOENT}
+	case node.dir:
+		return &os.PathError{Op: "open", Path: path, Err: syscall.EISDIR}
+	}
+	fs.write(node, data)
+	fs.report(fs.writeChanges(path, data)...)
+	return nil
+}
+
+// Chmod changes the permissions of a file or directory
+func (fs *FakeFS) Chmod(path string, mode os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path = filepath.Clean(path)
+	node, ok := fs.nodes[path]
+	if !ok {
+		return &os.PathError{Op: "chmod", Path: path, Err: syscall.ENOENT}
+	}
+	node.info.Mode = node.info.Mode&os.ModeType | mode.Perm()
+	node.info.ChangeTime = fs.clock.Now()
+	fs.report(fakeChange{path: path, dir: node.dir, action: event.FileAttributesChanged, op: "chmod"})
+	return nil
+}
+
+// Rename moves a file or directory, an existing file with the new name is replaced.
+// The rename is reported as FileRenamedNewName or DirRenamed if both names are watched,
+// as a removal if it's moved away and as an addition if it's moved in
+func (fs *FakeFS) Rename(oldPath, newPath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	node, ok := fs.nodes[oldPath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.ENOENT}
+	}
+	if isSubPath(oldPath, newPath) {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EINVAL}
+	}
+	if target, ok := fs.nodes[newPath]; ok {
+		if node.dir || target.dir {
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EEXIST}
+		}
+	} else if err := fs.checkNew("rename", newPath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err.(*os.PathError).Err}
+	}
+
+	for path, n := range fs.nodes {
+		if isSubPath(oldPath, path) {
+			delete(fs.nodes, path)
+			fs.nodes[newPath+path[len(oldPath):]] = n
+		}
+	}
+	fs.report(fakeChange{path: newPath, oldPath: oldPath, dir: node.dir, op: "rename"})
+	return nil
+}
+
+// Remove removes a file or an empty directory
+func (fs *FakeFS) Remove(path string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path = filepath.Clean(path)
+	node, ok := fs.nodes[path]
+	if !ok {
+		return &os.PathError{Op: "remove", Path: path, Err: syscall.ENOENT}
+	}
+	if node.dir && len(fs.below(path)) > 0 {
+		return &os.PathError{Op: "remove", Path: path, Err: syscall.ENOTEMPTY}
+	}
+	delete(fs.nodes, path)
+	fs.report(fs.removeChange(path, node))
+	return nil
+}
+
+// RemoveAll removes a path and everything it contains, the contents are removed first
+func (fs *FakeFS) RemoveAll(path string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path = filepath.Clean(path)
+	node, ok := fs.nodes[path]
+	if !ok {
+		return nil
+	}
+	paths := fs.below(path)
+	// the deepest entries are removed first, like rm -rf does it
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	var changes []fakeChange
+	for _, p := range paths {
+		changes = append(changes, fs.removeChange(p, fs.nodes[p]))
+		delete(fs.nodes, p)
+	}
+	delete(fs.nodes, path)
+	changes = append(changes, fs.removeChange(path, node))
+	fs.report(changes...)
+	return nil
+}
+
+// ReadFile returns the data of a file
+func (fs *FakeFS) ReadFile(path string) ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path = filepath.Clean(path)
+	node, ok := fs.nodes[path]
+	switch {
+	case !ok:
+		return nil, &os.PathError{Op: "open", Path: path, Err: syscall.ENOENT}
+	case node.dir:
+		return nil, &os.PathError{Op: "read", Path: path, Err: syscall.EISDIR}
+	}
+	return append([]byte(nil), node.data...), nil
+}
+
+// Load copies a directory of the real file system with its contents into the
+// file system without reporting them, e.g. the testdata of a test
+func (fs *FakeFS) Load(dir string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	dir = filepath.Clean(dir)
+	for parent := filepath.Dir(dir); ; parent = filepath.Dir(parent) {
+		if _, ok := fs.lookup(parent); ok {
+			break
+		}
+		fs.add(parent, true, nil)
+	}
+	// the watches waiting for their root see the loaded paths
+	defer fs.wake()
+	return filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		var data []byte
+		if !f.IsDir() {
+			if data, err = os.ReadFile(path); err != nil {
+				return err
+			}
+		}
+		fs.add(path, f.IsDir(), data)
+		fs.nodes[path].info = fileutil.Info(f)
+		return nil
+	})
+}
+
+// stat returns the metadata of a path, the info of the node is returned by Sys
+func (fs *FakeFS) stat(path string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path = filepath.Clean(path)
+	node, ok := fs.lookup(path)
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: syscall.ENOENT}
+	}
+	return fakeFileInfo{name: filepath.Base(path), dir: node.dir, info: node.info}, nil
+}
+
+// walk reports root and the paths below it in lexical order, the rest of a
+// directory is skipped if fn returns filepath.SkipDir like with filepath.Walk
+func (fs *FakeFS) walk(_ *watch, root string, fn filepath.WalkFunc) error {
+	root = filepath.Clean(root)
+	rootInfo, err := fs.stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	fs.mu.Lock()
+	paths := fs.below(root)
+	entries := make([]fakeFileInfo, 0, len(paths))
+	for _, path := range paths {
+		node := fs.nodes[path]
+		entries = append(entries, fakeFileInfo{name: filepath.Base(path), dir: node.dir, info: node.info})
+	}
+	fs.mu.Unlock()
+
+	if err := fn(root, rootInfo, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	var skipped []string
+	for i, path := range paths {
+		if isBelowAny(skipped, path) {
+			continue
+		}
+		err := fn(path, entries[i], nil)
+		if err == filepath.SkipDir {
+			if entries[i].dir {
+				skipped = append(skipped, path)
+			} else {
+				skipped = append(skipped, filepath.Dir(path))
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isBelowAny returns true if the path is inside of one of the directories
+func isBelowAny(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if path != dir && isSubPath(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForCreation blocks until the root of the watch is created
+func (fs *FakeFS) waitForCreation(wt *watch) bool {
+	for {
+		fs.mu.Lock()
+		_, ok := fs.lookup(filepath.Clean(wt.path))
+		changed := fs.changed
+		fs.mu.Unlock()
+		if ok {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-wt.stopped():
+			return false
+		}
+	}
+}
+
+// fakeFileInfo is the os.FileInfo of a node
+type fakeFileInfo struct {
+	name string
+	dir  bool
+	info event.AdditionalInfo
+}
+
+func (f fakeFileInfo) Name() string       { return f.name }
+func (f fakeFileInfo) Size() int64        { return f.info.Size }
+func (f fakeFileInfo) ModTime() time.Time { return f.info.ModTime }
+func (f fakeFileInfo) IsDir() bool        { return f.dir }
+func (f fakeFileInfo) Sys() interface{}   { return &f.info }
+
+func (f fakeFileInfo) Mode() os.FileMode {
+	if f.dir {
+		return f.info.Mode | os.ModeDir
+	}
+	return f.info.Mode
+}
+
+// lookup returns the node of the path, the root of the file system is always a directory
+func (fs *FakeFS) lookup(path string) (*fakeNode, bool) {
+	if filepath.Dir(path) == path {
+		return &fakeNode{dir: true}, true
+	}
+	node, ok := fs.nodes[path]
+	return node, ok
+}
+
+// checkNew returns an error if the path exists or its parent is not a directory
+func (fs *FakeFS) checkNew(op, path string) error {
+	if _, ok := fs.lookup(path); ok {
+		return &os.PathError{Op: op, Path: path, Err: syscall.EEXIST}
+	}
+	parent, ok := fs.lookup(filepath.Dir(path))
+	switch {
+	case !ok:
+		return &os.PathError{Op: op, Path: path, Err: syscall.ENOENT}
+	case !parent.dir:
+		return &os.PathError{Op: op, Path: path, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+func (fs *FakeFS) add(path string, dir bool, data []byte) {
+	fs.inodes++
+	mode := os.FileMode(0o644)
+	if dir {
+		mode = os.ModeDir | 0o755
+	}
+	now := fs.clock.Now()
+	fs.nodes[path] = &fakeNode{
+		dir:  dir,
+		data: append([]byte(nil), data...),
+		info: event.AdditionalInfo{
+			Size:       int64(len(data)),
+			ModTime:    now,
+			ChangeTime: now,
+			Mode:       mode,
+			Inode:      fs.inodes,
+			Nlink:      1,
+		},
+	}
+}
+
+func (fs *FakeFS) write(node *fakeNode, data []byte) {
+	node.data = append([]byte(nil), data...)
+	node.info.Size = int64(len(data))
+	node.info.ModTime = fs.clock.Now()
+	node.info.ChangeTime = node.info.ModTime
+}
+
+// writeChanges are the changes of a write, the data is modified and the file is closed
+func (fs *FakeFS) writeChanges(path string, data []byte) []fakeChange {
+	var changes []fakeChange
+	if len(data) > 0 {
+		changes = append(changes, fakeChange{path: path, action: event.FileModified, op: "write"})
+	}
+	return append(changes, fakeChange{path: path, action: event.FileModified, op: "close"})
+}
+
+func (fs *FakeFS) removeChange(path string, node *fakeNode) fakeChange {
+	if node.dir {
+		return fakeChange{path: path, dir: true, action: event.DirRemoved, op: "remove"}
+	}
+	return fakeChange{path: path, action: event.FileRemoved, op: "remove"}
+}
+
+// below returns the sorted paths inside of a directory
+func (fs *FakeFS) below(dir string) []string {
+	var paths []string
+	for path := range fs.nodes {
+		if path != dir && isSubPath(dir, path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// info returns the metadata of the path as it's read by a backend after the change
+func (fs *FakeFS) info(path string) *event.AdditionalInfo {
+	node, ok := fs.nodes[path]
+	if !ok {
+		return nil
+	}
+	info := node.info
+	return &info
+}
+
+// covers returns true if the watch reports the changes of the path
+func (fs *FakeFS) covers(wt *watch, path string) bool {
+	if wt.file {
+		// a single file is watched with its directory, like the real backends do it
+		return filepath.Dir(path) == filepath.Dir(wt.path)
+	}
+	if path == wt.path || !isSubPath(wt.path, path) {
+		return false
+	}
+	return wt.options.Recursive || filepath.Dir(path) == wt.path
+}
+
+// report passes the changes to all watches and checks if their roots are lost or back
+func (fs *FakeFS) report(changes ...fakeChange) {
+	for _, fw := range fs.watches {
+		if fw.lost != nil {
+			continue
+		}
+		for _, c := range changes {
+			if c.oldPath != "" {
+				fs.renamed(fw.wt, c)
+				continue
+			}
+			fs.notify(fw.wt, c.path, c.action, nil, FakeRecord{Op: c.op, Path: c.path})
+		}
+	}
+	if len(changes) > 0 {
+		last := changes[len(changes)-1]
+		fs.checkRoots(FakeRecord{Op: last.op, Path: last.path, OldPath: last.oldPath})
+		fs.wake()
+	}
+}
+
+// wake wakes the watches waiting for their root to check it again
+func (fs *FakeFS) wake() {
+	close(fs.changed)
+	fs.changed = make(chan struct{})
+}
+
+// notify reports a change if the watch covers the path
+func (fs *FakeFS) notify(wt *watch, path string, action event.ActionType, info *event.AdditionalInfo, record FakeRecord) {
+	if !fs.covers(wt, path) {
+		return
+	}
+	if wt.file {
+		var ok bool
+		if action, ok = wt.fileAction(path, action); !ok {
+			return
+		}
+	}
+	if info == nil {
+		info = fs.info(path)
+	}
+	wt.fileChangeNotifier(path, action, info, nil, record)
+}
+
+// renamed reports a rename like the inotify backend after pairing IN_MOVED_FROM and IN_MOVED_TO
+func (fs *FakeFS) renamed(wt *watch, c fakeChange) {
+	record := FakeRecord{Op: c.op, Path: c.path, OldPath: c.oldPath}
+	oldCovered, newCovered := fs.covers(wt, c.oldPath), fs.covers(wt, c.path)
+	switch {
+	case wt.file:
+		// the renames of the directory of a single file are not paired
+		fs.notify(wt, c.oldPath, event.FileRenamedOldName, nil, record)
+		fs.notify(wt, c.path, event.FileRenamedNewName, nil, record)
+	case oldCovered && newCovered:
+		action := event.FileRenamedNewName
+		if c.dir {
+			action = event.DirRenamed
+		}
+		info := fs.info(c.path)
+		info.OldName = c.oldPath
+		fs.notify(wt, c.path, action, info, record)
+	case oldCovered:
+		// moved away
+		fs.notify(wt, c.oldPath, fs.removeChange(c.oldPath, &fakeNode{dir: c.dir}).action, nil, record)
+	case newCovered && c.dir:
+		// moved in, the contents of a directory are reported like a new directory
+		fs.notify(wt, c.path, event.DirAdded, nil, record)
+		for _, path := range fs.below(c.path) {
+			action := event.FileAdded
+			if fs.nodes[path].dir {
+				action = event.DirAdded
+			}
+			fs.notify(wt, path, action, nil, record)
+		}
+	case newCovered:
+		fs.notify(wt, c.path, event.FileAdded, nil, record)
+	}
+}
+
+// checkRoots ends the watches whose root is gone, with WaitForRoot the watch is resumed
+// when the root is back and everything it contains by then is reported as added
+func (fs *FakeFS) checkRoots(record FakeRecord) {
+	for wt, fw := range fs.watches {
+		root, exists := fs.lookup(wt.watchedDir())
+		exists = exists && root.dir
+		switch {
+		case fw.lost == nil && !exists:
+			lost := make(chan struct{})
+			fw.lost = lost
+			if !wt.options.WaitForRoot {
+				delete(fs.watches, wt)
+			}
+			// the pending events are flushed, it must not block the changes of the file system
+			go func(wt *watch) {
+				defer close(lost)
+				wt.rootLost(record)
+				if !wt.options.WaitForRoot {
+					wt.finish(ErrRootLost)
+				}
+			}(wt)
+		case fw.lost != nil && exists:
+			lost := fw.lost
+			fw.lost = nil
+			var added []fakeChange
+			for _, path := range fs.below(wt.watchedDir()) {
+				// a single file is reported alone, not the other files of its directory
+				if fs.covers(wt, path) && (!wt.file || path == wt.path) {
+					added = append(added, fakeChange{path: path, dir: fs.nodes[path].dir})
+				}
+			}
+			infos := make([]*event.AdditionalInfo, len(added))
+			for i, c := range added {
+				infos[i] = fs.info(c.path)
+			}
+			go func(wt *watch) {
+				<-lost
+				wt.fileDebug("INFO", fmt.Sprintf("the watched root [%s] is back", wt.path))
+				for i, c := range added {
+					action := event.FileAdded
+					if c.dir {
+						action = event.DirAdded
+					}
+					wt.fileChangeNotifier(c.path, action, infos[i], nil)
+				}
+			}(wt)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package watcher_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sevigo/notify/clock"
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/watcher"
+)
+
+// advance fires the debouncing of the pending notifications and returns the events sent by then
+func advance(t *testing.T, c *clock.Fake, ch chan event.Event, count int) []event.Event {
+	t.Helper()
+	c.BlockUntil(count)
+	c.Advance(time.Second)
+	events := make([]event.Event, 0, count)
+	for len(events) < count {
+		events = append(events, <-ch)
+	}
+	return events
+}
+
+func TestFakeFS(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	fs := watcher.NewFakeFS("fakefs", c)
+	root := filepath.FromSlash("/data")
+	require.NoError(t, fs.MkdirAll(root))
+
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:      "fakefs",
+		Recursive:    true,
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+	})
+	require.NoError(t, err)
+
+	// the file is added and modified twice, the modifications are merged
+	file := filepath.Join(root, "a.txt")
+	created := c.Now()
+	require.NoError(t, fs.Create(file, []byte("test")))
+	e := advance(t, c, eventCh, 1)[0]
+	assert.Equal(t, event.FileAdded, e.Action)
+	assert.Equal(t, file, e.Path)
+	assert.Equal(t, int64(4), e.Size)
+	assert.Equal(t, created, e.ModTime)
+	assert.Equal(t, 0, c.Timers())
+
+	// every change moves the deadline of the debouncing
+	require.NoError(t, fs.Write(file, []byte("changed")))
+	c.BlockUntil(1)
+	c.Advance(500 * time.Millisecond)
+	require.NoError(t, fs.Write(file, []byte("changed again")))
+	c.Advance(500 * time.Millisecond)
+	select {
+	case e := <-eventCh:
+		t.Fatalf("got %v before the deadline", e)
+	default:
+	}
+	c.BlockUntil(1)
+	c.Advance(500 * time.Millisecond)
+	e = <-eventCh
+	assert.Equal(t, event.FileModified, e.Action)
+	// the event reports the metadata of the last merged change
+	assert.Equal(t, int64(13), e.Size)
+
+	renamed := filepath.Join(root, "b.txt")
+	require.NoError(t, fs.Rename(file, renamed))
+	e = advance(t, c, eventCh, 1)[0]
+	assert.Equal(t, event.FileRenamedNewName, e.Action)
+	assert.Equal(t, renamed, e.Path)
+	assert.Equal(t, file, e.OldName)
+
+	sub := filepath.Join(root, "sub")
+	require.NoError(t, fs.Mkdir(sub))
+	require.NoError(t, fs.Create(filepath.Join(sub, "c.txt"), nil))
+	events := advance(t, c, eventCh, 2)
+	actions := map[string]event.ActionType{}
+	for _, e := range events {
+		actions[e.RelativePath] = e.Action
+	}
+	assert.Equal(t, map[string]event.ActionType{
+		"sub":                         event.DirAdded,
+		filepath.Join("sub", "c.txt"): event.FileAdded,
+	}, actions)
+
+	assert.True(t, os.IsNotExist(fs.Create(filepath.Join(root, "missing", "d.txt"), nil)))
+	assert.Error(t, fs.Remove(sub))
+	require.NoError(t, fs.RemoveAll(sub))
+	events = advance(t, c, eventCh, 2)
+	actions = map[string]event.ActionType{}
+	for _, e := range events {
+		actions[e.RelativePath] = e.Action
+	}
+	assert.Equal(t, map[string]event.ActionType{
+		"sub":                         event.DirRemoved,
+		filepath.Join("sub", "c.txt"): event.FileRemoved,
+	}, actions)
+
+	// the watch ends when its root is removed, the pending events are sent without waiting
+	require.NoError(t, fs.RemoveAll(root))
+	e = <-eventCh
+	assert.Equal(t, event.FileRemoved, e.Action)
+	e = <-eventCh
+	assert.Equal(t, event.WatchRootLost, e.Action)
+	<-w.Done()
+	assert.Equal(t, watcher.ErrRootLost, w.Err())
+}
+
+func TestFakeFSMergedMetadata(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	fs := watcher.NewFakeFS("fakefs-metadata", c)
+	root := filepath.FromSlash("/data")
+	require.NoError(t, fs.MkdirAll(root))
+
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:      "fakefs-metadata",
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// the file is empty when it's created, it's written before the event is sent
+	file := filepath.Join(root, "a.txt")
+	require.NoError(t, fs.Create(file, nil))
+	c.BlockUntil(1)
+	c.Advance(500 * time.Millisecond)
+	written := c.Now()
+	require.NoError(t, fs.Write(file, []byte("hello world")))
+	e := advance(t, c, eventCh, 1)[0]
+	assert.Equal(t, event.FileAdded, e.Action)
+	assert.Equal(t, int64(11), e.Size)
+	assert.Equal(t, written, e.ModTime)
+}
+
+func TestFakeFSFilters(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	fs := watcher.NewFakeFS("fakefs-filters", c)
+	root := filepath.FromSlash("/data")
+	sub := filepath.Join(root, "sub")
+	file := filepath.Join(root, "a.txt")
+	require.NoError(t, fs.MkdirAll(sub))
+	require.NoError(t, fs.Create(file, []byte("a")))
+
+	dirCh := make(chan event.Event)
+	dir, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:      "fakefs-filters",
+		EventCh:      dirCh,
+		ErrorHandler: func(event.Error) {},
+	})
+	require.NoError(t, err)
+	defer dir.Stop()
+	fileCh := make(chan event.Event)
+	single, err := directoryWatcher.StartWatching(context.TODO(), file, &core.WatchingOptions{
+		Backend:      "fakefs-filters",
+		EventCh:      fileCh,
+		ErrorHandler: func(event.Error) {},
+	})
+	require.NoError(t, err)
+	defer single.Stop()
+
+	// the sub-directory is not watched without Recursive, the other file not by the single file watch
+	require.NoError(t, fs.Create(filepath.Join(sub, "b.txt"), []byte("b")))
+	require.NoError(t, fs.Create(filepath.Join(root, "c.txt"), []byte("c")))
+	e := advance(t, c, dirCh, 1)[0]
+	assert.Equal(t, "c.txt", e.RelativePath)
+	assert.Equal(t, event.FileAdded, e.Action)
+
+	// a file moved over the watched one replaces it
+	require.NoError(t, fs.Rename(filepath.Join(root, "c.txt"), file))
+	c.BlockUntil(2)
+	c.Advance(time.Second)
+	e = <-fileCh
+	assert.Equal(t, file, e.Path)
+	assert.Equal(t, event.FileReplaced, e.Action)
+	e = <-dirCh
+	assert.Equal(t, event.FileRenamedNewName, e.Action)
+
+	// the file is removed and created again before the events are sent
+	require.NoError(t, fs.Remove(file))
+	c.BlockUntil(2)
+	c.Advance(20 * time.Millisecond)
+	require.NoError(t, fs.Create(file, []byte("new")))
+	c.Advance(time.Second)
+	e = <-fileCh
+	assert.Equal(t, event.FileReplaced, e.Action)
+	assert.Equal(t, int64(3), e.Size)
+	e = <-dirCh
+	assert.Equal(t, event.FileReplaced, e.Action)
+
+	select {
+	case e := <-dirCh:
+		t.Fatalf("unexpected event %v", e)
+	case e := <-fileCh:
+		t.Fatalf("unexpected event %v", e)
+	default:
+	}
+}
+
+func TestFakeFSRescan(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	fs := watcher.NewFakeFS("fakefs-rescan", c)
+	root := filepath.FromSlash("/rescan")
+	sub := filepath.Join(root, "sub")
+	file := filepath.Join(sub, "a.txt")
+
+	// the root is looked up in the model, the watch waits until it's created there
+	waitCh := make(chan event.Event)
+	wait, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:         "fakefs-rescan",
+		Recursive:       true,
+		WaitForCreation: true,
+		EventCh:         waitCh,
+		ErrorHandler:    func(event.Error) {},
+	})
+	require.NoError(t, err)
+	defer wait.Stop()
+	created := c.Now()
+	require.NoError(t, fs.MkdirAll(sub))
+	e := advance(t, c, waitCh, 1)[0]
+	assert.Equal(t, event.DirAdded, e.Action)
+	assert.Equal(t, sub, e.Path)
+	assert.Equal(t, created, e.ModTime)
+
+	require.NoError(t, fs.Create(file, []byte("test")))
+	e = advance(t, c, waitCh, 1)[0]
+	assert.Equal(t, event.FileAdded, e.Action)
+	assert.Equal(t, file, e.Path)
+
+	// the scan of a single file reports the file from the model
+	fileCh := make(chan event.Event)
+	single, err := directoryWatcher.StartWatching(context.TODO(), file, &core.WatchingOptions{
+		Backend:      "fakefs-rescan",
+		Rescan:       true,
+		EventCh:      fileCh,
+		ErrorHandler: func(event.Error) {},
+	})
+	require.NoError(t, err)
+	defer single.Stop()
+	e = advance(t, c, fileCh, 1)[0]
+	assert.Equal(t, event.FileAdded, e.Action)
+	assert.Equal(t, file, e.Path)
+	assert.Equal(t, int64(4), e.Size)
+}
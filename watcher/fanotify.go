@@ -0,0 +1,11 @@
+package watcher
+
+import "errors"
+
+// ErrFanotifyPermission is returned by StartWatching with the fanotify backend
+// if the process lacks the CAP_SYS_ADMIN capability
+var ErrFanotifyPermission = errors.New("fanotify needs the CAP_SYS_ADMIN capability")
+
+// ErrFanotifyUnsupported is returned by StartWatching with the fanotify backend if the OS
+// doesn't support fanotify with directory file handles, it needs Linux 5.9 or later
+var ErrFanotifyUnsupported = errors.New("fanotify with FAN_REPORT_DFID_NAME is not supported")
@@ -0,0 +1,546 @@
+//go:build linux && !integration && !fake
+
+package watcher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
+)
+
+// fanotifyMask is the mask of the file system mark, FAN_ONDIR adds the events of the directories
+const fanotifyMask = unix.FAN_CREATE | unix.FAN_DELETE | unix.FAN_CLOSE_WRITE | unix.FAN_ATTRIB | unix.FAN_ONDIR
+
+// fanotifyReadMask is added to the fanotifyMask if the read events are enabled
+const fanotifyReadMask = unix.FAN_OPEN | unix.FAN_ACCESS | unix.FAN_CLOSE_NOWRITE
+
+// fanotifyMetadataLen is the size of struct fanotify_event_metadata
+const fanotifyMetadataLen = 24
+
+// fanotifyBufferSize is the size of the buffer the events are read into
+const fanotifyBufferSize = 64 * 1024
+
+// fanotifyOutsideLimit is the number of directories outside of the watch which are remembered
+const fanotifyOutsideLimit = 4096
+
+func init() {
+	registerBuiltinBackend("fanotify", (*DirectoryWatcher).startFanotify)
+}
+
+func convertFanotifyMask(mask uint64) event.ActionType {
+	isDir := mask&unix.FAN_ONDIR != 0
+	switch {
+	case mask&unix.FAN_CREATE != 0:
+		if isDir {
+			return event.DirAdded
+		}
+		return event.FileAdded
+	case mask&unix.FAN_DELETE != 0:
+		if isDir {
+			return event.DirRemoved
+		}
+		return event.FileRemoved
+	case mask&(unix.FAN_MODIFY|unix.FAN_CLOSE_WRITE) != 0:
+		if isDir {
+			return event.Invalid
+		}
+		return event.FileModified
+	case mask&unix.FAN_ATTRIB != 0:
+		return event.FileAttributesChanged
+	case mask&unix.FAN_OPEN != 0:
+		if isDir {
+			return event.Invalid
+		}
+		return event.FileOpened
+	case mask&unix.FAN_ACCESS != 0:
+		if isDir {
+			return event.Invalid
+		}
+		return event.FileAccessed
+	case mask&unix.FAN_CLOSE_NOWRITE != 0:
+		if isDir {
+			return event.Invalid
+		}
+		return event.FileClosedNoWrite
+	case mask&unix.FAN_MOVED_FROM != 0:
+		if isDir {
+			return event.DirRemoved
+		}
+		return event.FileRemoved
+	case mask&unix.FAN_MOVED_TO != 0:
+		if isDir {
+			return event.DirAdded
+		}
+		return event.FileAdded
+	default:
+		return event.Invalid
+	}
+}
+
+// fanotifyWatch holds the fanotify group of a single watch, it marks the whole
+// file system of the watched path and drops the events of the other paths
+type fanotifyWatch struct {
+	*watch
+	fd int
+	// mountFd is the watched directory, the file handles of the events are opened with it
+	mountFd int
+	stopFd  [2]int
+	// known is the attribute cache when the root was lost, it's set until the root is back
+	known map[string]event.AdditionalInfo
+	// dirs maps the file handles to the watched directories, the events of a directory
+	// which was removed before they were read are resolved with it
+	dirs map[string]string
+	// outside holds the file handles of the directories outside of the watch,
+	// the events of the rest of the file system are dropped without resolving them
+	outside map[string]bool
+	// processes caches the processes looked up for the events of one read
+	processes map[int32]*event.Process
+}
+
+// startFanotify marks the file system of the watched path and starts reading the events
+func (w *DirectoryWatcher) startFanotify(wt *watch) error {
+	if err := checkWatchable(wt.path); err != nil {
+		return err
+	}
+	fw := &fanotifyWatch{watch: wt, dirs: make(map[string]string), outside: make(map[string]bool)}
+	if err := fw.open(); err != nil {
+		return fmt.Errorf("cannot start watching [%s]: %w", wt.path, err)
+	}
+	go fw.run()
+	return nil
+}
+
+// open creates the fanotify group and marks the file system of the watched directory
+func (fw *fanotifyWatch) open() error {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_REPORT_DFID_NAME, unix.O_RDONLY|unix.O_CLOEXEC)
+	switch {
+	case err == unix.EPERM:
+		return ErrFanotifyPermission
+	case err == unix.EINVAL || err == unix.ENOSYS:
+		return ErrFanotifyUnsupported
+	case err != nil:
+		return fmt.Errorf("fanotify_init: %v", err)
+	}
+
+	var mask uint64 = fanotifyMask
+	if fw.options.ReadEvents {
+		mask |= fanotifyReadMask
+	}
+	dir := fw.watchedDir()
+	err = unix.FanotifyMark(fd, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, mask|unix.FAN_RENAME, unix.AT_FDCWD, dir)
+	if err == unix.EINVAL {
+		// FAN_RENAME needs Linux 5.17, the moves are reported as removed and added without it
+		err = unix.FanotifyMark(fd, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, mask|unix.FAN_MOVED_FROM|unix.FAN_MOVED_TO, unix.AT_FDCWD, dir)
+	}
+	if err != nil {
+		unix.Close(fd)
+		if err == unix.EPERM {
+			return ErrFanotifyPermission
+		}
+		return fmt.Errorf("fanotify_mark: %v", err)
+	}
+	mountFd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		unix.Close(fd)
+		return err
+	}
+	if err := unix.Pipe2(fw.stopFd[:], unix.O_CLOEXEC); err != nil {
+		unix.Close(fd)
+		unix.Close(mountFd)
+		return err
+	}
+	fw.fd = fd
+	fw.mountFd = mountFd
+	fw.snapshot()
+	return nil
+}
+
+// snapshot fills the attribute cache with the watched directories, the
+// file system mark needs no walk but the changed attributes are reported
+func (fw *fanotifyWatch) snapshot() {
+	switch {
+	case fw.file:
+		fw.attributes.snapshotFile(fw.path)
+	case !fw.options.Recursive:
+		fw.attributes.snapshot(fw.path)
+	default:
+		fw.walk(fw.path, func(path string, f os.FileInfo, err error) error {
+			if err == nil && f.IsDir() {
+				fw.attributes.snapshot(path)
+			}
+			return nil
+		})
+	}
+}
+
+// run blocks until the watch is stopped, reading the events has failed or the root is lost
+func (fw *fanotifyWatch) run() {
+	readDone := make(chan struct{})
+	stopDone := make(chan struct{})
+	go func() {
+		defer close(stopDone)
+		select {
+		case <-fw.stopped():
+			unix.Write(fw.stopFd[1], []byte{0})
+		case <-readDone:
+		}
+	}()
+
+	err := fw.read()
+
+	close(readDone)
+	<-stopDone
+	unix.Close(fw.fd)
+	unix.Close(fw.mountFd)
+	unix.Close(fw.stopFd[0])
+	unix.Close(fw.stopFd[1])
+
+	fw.finish(err)
+}
+
+// read reads the events until something is written to the stop pipe,
+// it returns ErrRootLost if the watch has ended with its root
+func (fw *fanotifyWatch) read() error {
+	buf := make([]byte, fanotifyBufferSize)
+	fds := []unix.PollFd{
+		{Fd: int32(fw.fd), Events: unix.POLLIN},
+		{Fd: int32(fw.stopFd[0]), Events: unix.POLLIN},
+	}
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			err = fmt.Errorf("reading events for [%s] has failed: %v", fw.path, err)
+			fw.fileError("ERROR", err)
+			return err
+		}
+		if fds[1].Revents != 0 {
+			return nil
+		}
+		if fds[0].Revents&unix.POLLIN == 0 {
+			continue
+		}
+
+		n, err := unix.Read(fw.fd, buf)
+		if err == unix.EINTR || err == unix.EAGAIN {
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("reading events for [%s] has failed: %v", fw.path, err)
+			fw.fileError("ERROR", err)
+			return err
+		}
+		if !fw.handleEvents(buf[:n]) {
+			return ErrRootLost
+		}
+	}
+}
+
+// handleEvents splits the buffer into the single events, it returns false if the root is lost
+func (fw *fanotifyWatch) handleEvents(buf []byte) bool {
+	// a process may have exec'd or exited until the next read
+	fw.processes = nil
+	for len(buf) >= fanotifyMetadataLen {
+		// struct fanotify_event_metadata
+		eventLen := int(binary.NativeEndian.Uint32(buf[0:4]))
+		version := buf[4]
+		metadataLen := int(binary.NativeEndian.Uint16(buf[6:8]))
+		mask := binary.NativeEndian.Uint64(buf[8:16])
+		fd := int32(binary.NativeEndian.Uint32(buf[16:20]))
+		pid := int32(binary.NativeEndian.Uint32(buf[20:24]))
+		if eventLen < fanotifyMetadataLen || eventLen < metadataLen || eventLen > len(buf) {
+			return true
+		}
+		info := buf[metadataLen:eventLen]
+		buf = buf[eventLen:]
+
+		if fd >= 0 {
+			unix.Close(int(fd))
+		}
+		if version != unix.FANOTIFY_METADATA_VERSION {
+			continue
+		}
+		if !fw.handle(mask, pid, info) {
+			return false
+		}
+	}
+	return true
+}
+
+// handle processes a single fanotify event, it returns false if the root is lost
+func (fw *fanotifyWatch) handle(mask uint64, pid int32, info []byte) bool {
+	if mask&unix.FAN_Q_OVERFLOW != 0 {
+		fw.fileError("WARNING", fmt.Errorf("events of [%s] were lost, the fanotify queue has overflowed", fw.path))
+		return true
+	}
+
+	record := FanotifyRecord{Mask: mask, Pid: pid}
+	for len(info) >= 4 {
+		// struct fanotify_event_info_header
+		infoType := info[0]
+		infoLen := int(binary.NativeEndian.Uint16(info[2:4]))
+		if infoLen < 4 || infoLen > len(info) {
+			break
+		}
+		dir, name := fw.resolve(info[4:infoLen])
+		switch infoType {
+		case unix.FAN_EVENT_INFO_TYPE_DFID_NAME, unix.FAN_EVENT_INFO_TYPE_NEW_DFID_NAME:
+			record.Dir, record.Name = dir, name
+		case unix.FAN_EVENT_INFO_TYPE_OLD_DFID_NAME:
+			record.OldDir, record.OldName = dir, name
+		}
+		info = info[infoLen:]
+	}
+
+	var path, oldPath string
+	if record.Dir != "" {
+		path = filepath.Join(record.Dir, record.Name)
+	}
+	if record.OldDir != "" {
+		oldPath = filepath.Join(record.OldDir, record.OldName)
+	}
+	if mask&unix.FAN_MOVED_FROM != 0 {
+		path, oldPath = "", path
+	}
+
+	root := fw.watchedDir()
+	if fw.known != nil {
+		if path == root {
+			known := fw.known
+			fw.known = nil
+			fw.fileDebug("INFO", fmt.Sprintf("the watched root [%s] is back", fw.path))
+			fw.reconcile(known)
+		}
+		return true
+	}
+	if oldPath == root || path == root && mask&unix.FAN_DELETE != 0 {
+		fw.dirs = make(map[string]string)
+		fw.outside = make(map[string]bool)
+		fw.rootLost(record)
+		if !fw.options.WaitForRoot {
+			return false
+		}
+		fw.known = fw.attributes.known()
+		return true
+	}
+	if !fw.inScope(path) {
+		path = ""
+	}
+	if !fw.inScope(oldPath) {
+		oldPath = ""
+	}
+	isDir := mask&unix.FAN_ONDIR != 0
+
+	if mask&unix.FAN_RENAME != 0 {
+		fw.renamed(oldPath, path, isDir, record)
+		return true
+	}
+	if path == "" && oldPath == "" {
+		return true
+	}
+	if oldPath != "" {
+		// moved away without FAN_RENAME
+		path = oldPath
+	}
+	action := convertFanotifyMask(mask)
+	if fw.file {
+		if action, ok := fw.fileAction(path, action); ok {
+			fw.notify(path, action, nil, record)
+		}
+		return true
+	}
+	if action == event.Invalid {
+		if fw.options.Raw {
+			fw.notify(path, event.Invalid, nil, record)
+		}
+		return true
+	}
+	if action == event.FileAdded && fw.isFollowedDir(path) {
+		action = event.DirAdded
+	}
+	fw.notify(path, action, nil, record)
+	switch {
+	case action == event.DirAdded && mask&unix.FAN_MOVED_TO != 0:
+		fw.addSubtree(path)
+	case action == event.DirRemoved:
+		fw.removeDirs(path)
+	}
+	return true
+}
+
+// notify reports a change, the process which made it is added if ProcessInfo is set.
+// It's only looked up for the changes which are reported, once for all events of the same read
+func (fw *fanotifyWatch) notify(path string, action event.ActionType, info *event.AdditionalInfo, record FanotifyRecord) {
+	var process *event.Process
+	if fw.options.ProcessInfo && record.Pid > 0 && !fw.isIgnoredSymlink(path) {
+		if fw.processes == nil {
+			fw.processes = make(map[int32]*event.Process)
+		}
+		if process = fw.processes[record.Pid]; process == nil {
+			process = lookupProcess(int(record.Pid))
+			fw.processes[record.Pid] = process
+		}
+	}
+	fw.fileChangeNotifier(path, action, info, process, record)
+}
+
+// renameDirs updates the cached paths of the directories after a rename
+func (fw *fanotifyWatch) renameDirs(oldRoot, newRoot string) {
+	for handle, dir := range fw.dirs {
+		if isSubPath(oldRoot, dir) {
+			fw.dirs[handle] = newRoot + dir[len(oldRoot):]
+		}
+	}
+}
+
+// removeDirs drops the cached paths of a removed directory
+func (fw *fanotifyWatch) removeDirs(root string) {
+	for handle, dir := range fw.dirs {
+		if isSubPath(root, dir) {
+			delete(fw.dirs, handle)
+		}
+	}
+}
+
+// renamed reports a FAN_RENAME, the paths outside of the watch are empty
+func (fw *fanotifyWatch) renamed(oldPath, path string, isDir bool, record FanotifyRecord) {
+	switch {
+	case fw.file:
+		// the renames are not paired, the watched file is either replaced or moved away
+		if action, ok := fw.fileAction(oldPath, event.FileRenamedOldName); ok {
+			fw.notify(oldPath, action, nil, record)
+		}
+		if action, ok := fw.fileAction(path, event.FileRenamedNewName); ok {
+			fw.notify(path, action, nil, record)
+		}
+	case oldPath != "" && path != "":
+		info := &event.AdditionalInfo{OldName: oldPath}
+		if isDir {
+			fw.renameDirs(oldPath, path)
+			fw.notify(path, event.DirRenamed, info, record)
+			return
+		}
+		fw.notify(path, event.FileRenamedNewName, info, record)
+	case oldPath != "":
+		// moved out of the watched directories
+		if isDir {
+			fw.removeDirs(oldPath)
+			fw.notify(oldPath, event.DirRemoved, nil, record)
+			return
+		}
+		fw.notify(oldPath, event.FileRemoved, nil, record)
+	case path != "":
+		// moved in from outside of the watched directories
+		if isDir {
+			fw.notify(path, event.DirAdded, nil, record)
+			fw.addSubtree(path)
+			return
+		}
+		fw.notify(path, event.FileAdded, nil, record)
+	}
+}
+
+// addSubtree reports the contents of a directory moved into a recursive watch,
+// the changes made later are reported by the file system mark
+func (fw *fanotifyWatch) addSubtree(root string) {
+	if !fw.options.Recursive {
+		return
+	}
+	// the directory may be remembered as outside of the watch
+	fw.outside = make(map[string]bool)
+	fw.walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		info := fileutil.Info(f)
+		if f.IsDir() {
+			fw.fileChangeNotifier(path, event.DirAdded, &info, nil)
+		} else {
+			fw.fileChangeNotifier(path, event.FileAdded, &info, nil)
+		}
+		return nil
+	})
+}
+
+// inScope returns true if a change of the path is reported by the watch
+func (fw *fanotifyWatch) inScope(path string) bool {
+	root := fw.watchedDir()
+	if path == "" || path == root {
+		return false
+	}
+	if fw.options.Recursive && !fw.file {
+		return isSubPath(root, path)
+	}
+	return filepath.Dir(path) == root
+}
+
+// watchesDir returns true if the changes inside of the directory can be reported by the watch
+func (fw *fanotifyWatch) watchesDir(dir string) bool {
+	root := fw.watchedDir()
+	if dir == root {
+		return true
+	}
+	return fw.options.Recursive && !fw.file && isSubPath(root, dir)
+}
+
+// resolve returns the directory and the name of a struct fanotify_event_info_fid. The watched
+// directories are resolved with the cache, the directory is empty if it's outside of the watch
+func (fw *fanotifyWatch) resolve(fid []byte) (string, string) {
+	// __kernel_fsid_t fsid, struct file_handle and the name
+	if len(fid) < 16 {
+		return "", ""
+	}
+	size := int(binary.NativeEndian.Uint32(fid[8:12]))
+	handleType := int32(binary.NativeEndian.Uint32(fid[12:16]))
+	if 16+size > len(fid) {
+		return "", ""
+	}
+	name := string(fid[16+size:])
+	if i := strings.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+
+	if name == "." {
+		// the event of the directory itself
+		name = ""
+	}
+
+	// the file system id and the file handle identify the directory
+	handle := string(fid[:16+size])
+	if dir, ok := fw.dirs[handle]; ok {
+		return dir, name
+	}
+	if fw.outside[handle] {
+		return "", name
+	}
+	fd, err := unix.OpenByHandleAt(fw.mountFd, unix.NewFileHandle(handleType, fid[16:16+size]), unix.O_PATH|unix.O_CLOEXEC)
+	if err != nil {
+		return "", name
+	}
+	defer unix.Close(fd)
+	dir, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil || strings.HasSuffix(dir, " (deleted)") {
+		return "", name
+	}
+	switch {
+	case fw.watchesDir(dir):
+		fw.dirs[handle] = dir
+	case dir == filepath.Dir(fw.watchedDir()):
+		// the parent reports the loss of the root, it's not cached as it may be moved
+	default:
+		if len(fw.outside) >= fanotifyOutsideLimit {
+			fw.outside = make(map[string]bool)
+		}
+		fw.outside[handle] = true
+		return "", name
+	}
+	return dir, name
+}
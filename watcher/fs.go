@@ -0,0 +1,63 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
+)
+
+// fileSystem is read by a watch to check its root and to scan it, it's the real
+// file system unless the backend of the watch models its own, e.g. a FakeFS
+type fileSystem interface {
+	stat(path string) (os.FileInfo, error)
+	// walk reports root and everything below it like the walk of the watch
+	walk(wt *watch, root string, fn filepath.WalkFunc) error
+	// waitForCreation blocks until the root of the watch exists,
+	// it returns false if the watch is stopped before
+	waitForCreation(wt *watch) bool
+}
+
+// osFileSystem is the real file system
+type osFileSystem struct{}
+
+func (osFileSystem) stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (osFileSystem) walk(wt *watch, root string, fn filepath.WalkFunc) error {
+	return wt.walk(root, fn)
+}
+
+func (osFileSystem) waitForCreation(wt *watch) bool {
+	return wt.waitForRoot()
+}
+
+// fileSystems holds the file systems of the backends which model their own, by the backend name
+var fileSystems = make(map[string]fileSystem)
+
+// registerFileSystem sets the file system of the watches of a registered backend
+func registerFileSystem(name string, fs fileSystem) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	fileSystems[name] = fs
+}
+
+// backendFileSystem returns the file system of the watches of a backend
+func backendFileSystem(name string) fileSystem {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	if fs, ok := fileSystems[name]; ok {
+		return fs
+	}
+	return osFileSystem{}
+}
+
+// entryInfo returns the metadata of a walked entry, a modelled file system provides it with Sys
+func entryInfo(f os.FileInfo) event.AdditionalInfo {
+	if info, ok := f.Sys().(*event.AdditionalInfo); ok {
+		return *info
+	}
+	return fileutil.Info(f)
+}
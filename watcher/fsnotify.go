@@ -0,0 +1,234 @@
+//go:build (darwin || (linux && !integration)) && !fake
+
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
+)
+
+func init() {
+	registerBuiltinBackend("fsnotify", (*DirectoryWatcher).startFsnotify)
+}
+
+func (w *DirectoryWatcher) addDirectoriesRecursively(wt *watch, watcher *fsnotify.Watcher, path string) error {
+	return wt.walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			wt.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is added to the watch", p))
+			if err := watcher.Add(p); err != nil {
+				return fmt.Errorf("can't watch [%s]: %v", p, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (w *DirectoryWatcher) handleEvents(wt *watch, watcher *fsnotify.Watcher) {
+	var err error
+	defer func() {
+		watcher.Close()
+		wt.finish(err)
+	}()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			wt.fileDebug("DEBUG", fmt.Sprintf("file [%s], fsnotify op [%s]", event.Name, event.Op))
+			record := FsnotifyRecord{Name: event.Name, Op: event.Op}
+			if event.Name == wt.watchedDir() && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				wt.rootLost(record)
+				if !wt.options.WaitForRoot {
+					err = ErrRootLost
+					return
+				}
+				known := wt.attributes.known()
+				watcher.Close()
+				if !wt.waitForRoot() {
+					return
+				}
+				next, openErr := w.openWatcher(wt)
+				if openErr != nil {
+					err = openErr
+					wt.fileError("ERROR", err)
+					return
+				}
+				watcher = next
+				wt.reconcile(known)
+				continue
+			}
+			mappedEvent, ok := mapEvent(event.Op)
+			if wt.file {
+				// only the watched file of the directory is reported
+				if mappedEvent, ok = wt.fileAction(event.Name, mappedEvent); ok {
+					wt.fileChangeNotifier(event.Name, mappedEvent, nil, nil, record)
+				}
+				continue
+			}
+			if !ok {
+				if wt.options.Raw {
+					wt.fileChangeNotifier(event.Name, mappedEvent, nil, nil, record)
+				}
+				continue
+			}
+			wt.notify(watcher, event.Name, mappedEvent, record)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			wt.fileError("ERROR", fmt.Errorf("fsnotify: %v", err))
+
+		case <-wt.stopped():
+			return
+		}
+	}
+}
+
+// startFsnotify watches the path with fsnotify, it's the default backend on macOS
+// and an alternative to the inotify backend on Linux
+func (w *DirectoryWatcher) startFsnotify(wt *watch) error {
+	if err := checkWatchable(wt.path); err != nil {
+		return err
+	}
+	watcher, err := w.openWatcher(wt)
+	if err != nil {
+		return err
+	}
+
+	// Start processing events in a separate goroutine
+	go w.handleEvents(wt, watcher)
+	return nil
+}
+
+// openWatcher creates a watcher and adds the root of the watch to it
+func (w *DirectoryWatcher) openWatcher(wt *watch) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if wt.options.Recursive && !wt.file {
+		err = w.addDirectoriesRecursively(wt, watcher, wt.path)
+	} else {
+		// a single file is watched with its directory, to keep tracking it after it was replaced
+		wt.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is added to the watch", wt.watchedDir()))
+		err = watcher.Add(wt.watchedDir())
+	}
+	if err == nil && wt.file {
+		wt.attributes.snapshotFile(wt.path)
+	}
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// notify translates fsnotify events to custom notification events
+func (wt *watch) notify(watcher *fsnotify.Watcher, absoluteFilePath string, action event.ActionType, record FsnotifyRecord) {
+	// fsnotify doesn't pair the old and the new name, a renamed directory
+	// is reported as removed and the new name as added
+	if action == event.FileRemoved || action == event.FileRenamedOldName {
+		if isWatchedDir(watcher, absoluteFilePath) {
+			unwatchSubtree(watcher, absoluteFilePath)
+			wt.fileChangeNotifier(absoluteFilePath, event.DirRemoved, nil, nil, record)
+			return
+		}
+	}
+
+	fileInfo, err := fileutil.CheckValidFile(absoluteFilePath, action)
+	if err != nil {
+		wt.fileDebug("DEBUG", fmt.Sprintf("file [%s] is skipped: %v", absoluteFilePath, err))
+		return
+	}
+	isDir := fileInfo != nil && fileInfo.IsDir() || action == event.FileAdded && wt.isFollowedDir(absoluteFilePath)
+	if isDir && action != event.FileAttributesChanged {
+		if action != event.FileAdded {
+			return
+		}
+		wt.fileChangeNotifier(absoluteFilePath, event.DirAdded, nil, nil, record)
+		if wt.options.Recursive {
+			wt.watchSubtree(watcher, absoluteFilePath)
+		}
+		return
+	}
+
+	wt.fileChangeNotifier(absoluteFilePath, action, nil, nil, record)
+}
+
+// watchSubtree adds a new directory to the watcher and reports everything
+// which was created inside of it before it was added
+func (wt *watch) watchSubtree(watcher *fsnotify.Watcher, root string) {
+	wt.walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			wt.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is excluded from watching because of an error: %v", path, err))
+			return nil
+		}
+		if f.IsDir() {
+			if ignoreFolders[f.Name()] {
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(path); err != nil {
+				wt.fileError("ERROR", fmt.Errorf("can't watch [%s]: %v", path, err))
+			}
+		}
+		if path == root {
+			return nil
+		}
+		info := fileutil.Info(f)
+		if f.IsDir() {
+			wt.fileChangeNotifier(path, event.DirAdded, &info, nil)
+		} else {
+			wt.fileChangeNotifier(path, event.FileAdded, &info, nil)
+		}
+		return nil
+	})
+}
+
+// unwatchSubtree removes a directory which was removed or moved away from the watcher
+func unwatchSubtree(watcher *fsnotify.Watcher, root string) {
+	for _, path := range watcher.WatchList() {
+		if isSubPath(root, path) {
+			_ = watcher.Remove(path)
+		}
+	}
+}
+
+func isWatchedDir(watcher *fsnotify.Watcher, path string) bool {
+	for _, p := range watcher.WatchList() {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// mapEvent maps fsnotify's events to custom event types, an event can combine several ops,
+// e.g. Write|Chmod on kqueue, the most significant one is reported
+func mapEvent(op fsnotify.Op) (event.ActionType, bool) {
+	switch {
+	case op.Has(fsnotify.Create):
+		return event.FileAdded, true
+	case op.Has(fsnotify.Remove):
+		return event.FileRemoved, true
+	case op.Has(fsnotify.Rename):
+		return event.FileRenamedOldName, true
+	case op.Has(fsnotify.Write):
+		return event.FileModified, true
+	case op.Has(fsnotify.Chmod):
+		return event.FileAttributesChanged, true
+	default:
+		return event.Invalid, false
+	}
+}
@@ -0,0 +1,101 @@
+//go:build linux && !integration && !fake
+
+package watcher
+
+// #include "watch_linux.h"
+import "C"
+import (
+	"fmt"
+
+	"github.com/sevigo/notify/event"
+)
+
+// pollDirectory serves a directory which can't get an inotify watch by polling,
+// the watch is degraded to a hybrid of inotify and polling from now on
+func (iw *inotifyWatch) pollDirectory(dir, reason string) {
+	iw.mu.Lock()
+	if iw.poller == nil {
+		iw.poller = newPoller(iw.watch)
+		iw.poller.partial = true
+		iw.poller.only = make(map[string]map[string]pollEntry)
+		iw.poller.dirAdded = func(dir string) {
+			if iw.options.Recursive {
+				iw.addSubtree(dir)
+			}
+		}
+		iw.poller.dirRenamed = iw.renameSubtree
+		iw.poller.afterPoll = iw.rebalance
+		go iw.poller.run()
+	}
+	if iw.degradation == "" {
+		iw.degradation = reason
+		iw.warnDegraded = true
+	}
+	iw.mu.Unlock()
+	iw.poller.add(dir)
+}
+
+// reportDegradation sends a warning when the watch has started to poll directories
+func (iw *inotifyWatch) reportDegradation() {
+	iw.mu.Lock()
+	if !iw.warnDegraded {
+		iw.mu.Unlock()
+		return
+	}
+	iw.warnDegraded = false
+	degradation := &event.Degradation{
+		Reason:     iw.degradation,
+		KernelDirs: len(iw.dirs),
+		PolledDirs: iw.poller.count(),
+	}
+	iw.mu.Unlock()
+
+	e := event.FormatError("WARNING", fmt.Sprintf("[%s] is partly polled, %d of %d directories can't be watched: %s",
+		iw.path, degradation.PolledDirs, degradation.KernelDirs+degradation.PolledDirs, degradation.Reason))
+	e.Path = iw.path
+	e.Degradation = degradation
+	iw.sendError(e)
+}
+
+// rebalance swaps the most active polled directory with the least active directory
+// watched by inotify, the hottest directories keep the kernel watches
+func (iw *inotifyWatch) rebalance() {
+	hotDir, hotCount := iw.poller.hottest()
+	iw.poller.decay()
+
+	iw.mu.Lock()
+	coldWd, coldDir, coldCount := -1, "", 0
+	for wd, dir := range iw.dirs {
+		if wd == iw.rootWd {
+			continue
+		}
+		if count := iw.activity[dir]; coldWd < 0 || count < coldCount {
+			coldWd, coldDir, coldCount = wd, dir, count
+		}
+	}
+	decayActivity(iw.activity)
+	iw.mu.Unlock()
+	if hotDir == "" || coldWd < 0 || coldCount >= hotCount {
+		return
+	}
+
+	// the cold directory is polled before its kernel watch is removed, no change is missed
+	iw.poller.add(coldDir)
+	iw.mu.Lock()
+	if iw.fd < 0 || iw.dirs[coldWd] != coldDir {
+		// the watch was closed or the directory was removed in the meantime
+		iw.mu.Unlock()
+		iw.poller.remove(coldDir)
+		return
+	}
+	C.RemoveWatch(C.int(iw.fd), C.int(coldWd))
+	delete(iw.dirs, coldWd)
+	iw.mu.Unlock()
+
+	iw.poller.remove(hotDir)
+	if err := iw.addDirectory(hotDir); err != nil {
+		iw.poller.add(hotDir)
+		return
+	}
+	iw.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is watched by inotify instead of [%s]", hotDir, coldDir))
+}
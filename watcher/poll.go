@@ -0,0 +1,567 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
+)
+
+// defaultPollInterval is used if the options of a polled watch have no interval
+const defaultPollInterval = time.Second
+
+func init() {
+	registerBuiltinBackend("poll", (*DirectoryWatcher).startPolling)
+}
+
+// errPollStopped is returned by a poll if the watch was stopped while it was waiting for its budget
+var errPollStopped = errors.New("the poll was stopped")
+
+// pollEntry is the state of a file or directory in a snapshot
+type pollEntry struct {
+	info  event.AdditionalInfo
+	isDir bool
+}
+
+// fileKey identifies the file by device and inode, it's used to detect the renames
+type fileKey struct {
+	device uint64
+	inode  uint64
+}
+
+// poller watches the path of a watch by comparing snapshots of its directories,
+// it's used for the file systems which don't provide kernel notifications
+type poller struct {
+	*watch
+	// interval is the time between two polls of an active directory, the inactive
+	// directories are backed off up to maxInterval
+	interval    time.Duration
+	maxInterval time.Duration
+	// limit is the budget of stat calls per second of this watch
+	limit *statLimiter
+
+	// dirs holds the entries of every polled directory
+	dirs map[string]map[string]pollEntry
+	// schedule holds the next poll of every polled directory
+	schedule map[string]*pollSchedule
+
+	// partial is set if the poller serves only some directories of a watch,
+	// they are polled without their sub-directories
+	partial bool
+	// mu guards only and activity, they are changed by the backend while polling
+	mu sync.Mutex
+	// only holds the directories of a partial poller with their listing when they were added,
+	// it's the base line of their first poll
+	only map[string]map[string]pollEntry
+	// activity counts the changes of each polled directory
+	activity map[string]int
+	// dirAdded and dirRenamed are called for the directories created or renamed
+	// in a directory of a partial poller, the backend decides how to watch them
+	dirAdded   func(dir string)
+	dirRenamed func(oldDir, newDir string)
+	// afterPoll is called after every poll of a partial poller
+	afterPoll func()
+}
+
+func newPoller(wt *watch) *poller {
+	p := &poller{
+		watch:       wt,
+		interval:    wt.options.PollInterval,
+		maxInterval: wt.options.PollMaxInterval,
+		limit:       newStatLimiter(wt.options.PollBudget, wt.clock),
+		dirs:        make(map[string]map[string]pollEntry),
+		schedule:    make(map[string]*pollSchedule),
+		activity:    make(map[string]int),
+	}
+	if p.interval <= 0 {
+		p.interval = defaultPollInterval
+	}
+	if p.maxInterval < p.interval {
+		p.maxInterval = pollBackoff * p.interval
+	}
+	return p
+}
+
+// startPolling takes the first snapshot of the watch and polls it in the background
+func (w *DirectoryWatcher) startPolling(wt *watch) error {
+	if err := checkWatchable(wt.path); err != nil {
+		return err
+	}
+	p := newPoller(wt)
+	if err := p.poll(false); err != nil {
+		return fmt.Errorf("cannot start watching [%s]: %v", wt.path, err)
+	}
+	go p.run()
+	return nil
+}
+
+// run polls the watch until it is stopped or its root is lost
+func (p *poller) run() {
+	for {
+		// the next poll is timed from the end of the last one, slow polls don't pile up
+		timer := p.clock.NewTimer(p.interval)
+		select {
+		case <-timer.C():
+		case <-p.stopped():
+			timer.Stop()
+			if !p.partial {
+				// a partial poller is ended by its backend
+				p.finish(nil)
+			}
+			return
+		}
+
+		err := p.poll(true)
+		if p.afterPoll != nil {
+			p.afterPoll()
+		}
+		if err == nil || err == errPollStopped {
+			continue
+		}
+		if !os.IsNotExist(err) {
+			p.fileError("ERROR", fmt.Errorf("can't poll [%s]: %v", p.path, err))
+			continue
+		}
+		p.rootLost()
+		if !p.options.WaitForRoot {
+			p.finish(ErrRootLost)
+			return
+		}
+		// the next poll compares the reappeared root with the last snapshot
+		if !p.waitForRoot() {
+			p.finish(nil)
+			return
+		}
+	}
+}
+
+// pollChanges are the differences found by a single poll
+type pollChanges struct {
+	added    []string
+	removed  []string
+	modified map[string]event.ActionType
+	entries  map[string]pollEntry
+	previous map[string]pollEntry
+}
+
+// poll lists the due directories of the watch and reports the differences to the last snapshot,
+// the directories which are not due are passed with their last entries
+func (p *poller) poll(report bool) error {
+	now := p.clock.Now()
+	changes := &pollChanges{
+		modified: make(map[string]event.ActionType),
+		entries:  make(map[string]pollEntry),
+		previous: make(map[string]pollEntry),
+	}
+	root := p.watchedDir()
+	queue := []string{root}
+	if p.partial {
+		root = ""
+		queue = p.onlyDirs()
+	}
+	visited := make(map[string]bool)
+	// polled holds the device and inode of the polled directories, a followed link loop is polled once
+	polled := make(map[fileKey]bool)
+	// created holds the directories which are new in this poll, their contents are new as well
+	created := make(map[string]bool)
+	// listed holds the directories listed by this poll, skipped the ones which were not due
+	listed := make(map[string]bool)
+	var skipped []string
+	force := false
+	if info, err := os.Stat(root); err == nil {
+		stat := fileutil.Info(info)
+		polled[fileKey{stat.Device, stat.Inode}] = true
+	} else if root != "" {
+		// the root is checked by every poll even if it's not due
+		return err
+	}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		if listed[dir] {
+			continue
+		}
+		visited[dir] = true
+
+		entries := p.dirs[dir]
+		if force || p.due(dir, now) {
+			listed[dir] = true
+			var err error
+			entries, err = p.list(dir)
+			if err == errPollStopped || err != nil && dir == root {
+				return err
+			}
+			if err != nil {
+				// the directory was removed since its parent was listed, the parent reports it with the next poll
+				p.remove(dir)
+				if schedule, ok := p.schedule[filepath.Dir(dir)]; ok {
+					schedule.next = now
+				}
+				continue
+			}
+			previous, known := p.dirs[dir]
+			if !known && p.partial {
+				previous, known = p.baseline(dir)
+			}
+			p.dirs[dir] = entries
+			changed := false
+			if !report || p.partial && !known {
+				// the directory couldn't be listed when it was added to the partial poller
+				for path, entry := range entries {
+					info := entry.info
+					p.attributes.update(path, event.FileAdded, &info)
+				}
+			} else {
+				changed = p.compare(changes, previous, entries, created[dir] || !known)
+			}
+			p.reschedule(dir, changed, now)
+		} else {
+			skipped = append(skipped, dir)
+		}
+
+		for path, entry := range entries {
+			if !entry.isDir || !p.options.Recursive || p.file || p.partial {
+				continue
+			}
+			if key := (fileKey{entry.info.Device, entry.info.Inode}); entry.info.Inode != 0 {
+				if polled[key] {
+					continue
+				}
+				polled[key] = true
+			}
+			if _, known := p.dirs[path]; !known {
+				created[path] = true
+			}
+			queue = append(queue, path)
+		}
+
+		if len(queue) == 0 && !force {
+			// the directories which were not due are listed if they may hold the other half of a rename
+			force = true
+			queue = p.pairing(changes, skipped)
+		}
+	}
+	for dir := range p.dirs {
+		if !visited[dir] {
+			// the contents of a removed or renamed directory are not reported on their own
+			delete(p.dirs, dir)
+			delete(p.schedule, dir)
+		}
+	}
+	if report {
+		p.report(changes)
+	}
+	return nil
+}
+
+// pairing returns the skipped directories which have to be listed to report the renames of a poll,
+// a removed entry may have been moved to any of them, an added one from those holding its inode
+func (p *poller) pairing(changes *pollChanges, skipped []string) []string {
+	if len(changes.removed) > 0 {
+		return skipped
+	}
+	added := make(map[fileKey]bool)
+	for _, path := range changes.added {
+		if info := changes.entries[path].info; info.Inode != 0 {
+			added[fileKey{info.Device, info.Inode}] = true
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	var dirs []string
+	for _, dir := range skipped {
+		for _, entry := range p.dirs[dir] {
+			if added[fileKey{entry.info.Device, entry.info.Inode}] {
+				dirs = append(dirs, dir)
+				break
+			}
+		}
+	}
+	return dirs
+}
+
+// onlyDirs returns the directories of a partial poller
+func (p *poller) onlyDirs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dirs := make([]string, 0, len(p.only))
+	for dir := range p.only {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// add polls a directory of a partial poller from the next poll on,
+// the changes made since it was added are reported by the next poll
+func (p *poller) add(dir string) {
+	entries, err := p.listDir(dir, false)
+	if err != nil {
+		entries = nil
+	}
+	for path, entry := range entries {
+		info := entry.info
+		p.attributes.update(path, event.FileAdded, &info)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.only[dir] = entries
+}
+
+// baseline returns the listing of a directory when it was added to a partial poller
+func (p *poller) baseline(dir string) (map[string]pollEntry, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries := p.only[dir]
+	p.only[dir] = nil
+	return entries, entries != nil
+}
+
+// remove stops polling a directory of a partial poller
+func (p *poller) remove(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.only, dir)
+	delete(p.activity, dir)
+}
+
+// rename updates the directories of a partial poller after a directory was renamed
+func (p *poller) rename(oldRoot, newRoot string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for dir, entries := range p.only {
+		if isSubPath(oldRoot, dir) {
+			delete(p.only, dir)
+			p.only[newRoot+dir[len(oldRoot):]] = entries
+		}
+	}
+}
+
+// clear stops polling all directories of a partial poller
+func (p *poller) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.only = make(map[string]map[string]pollEntry)
+	p.activity = make(map[string]int)
+}
+
+// count returns the number of the directories of a partial poller
+func (p *poller) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.only)
+}
+
+// touch counts a change of the directory of the path
+func (p *poller) touch(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.activity[filepath.Dir(path)]++
+}
+
+// hottest returns the polled directory with the most changes
+func (p *poller) hottest() (string, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var hot string
+	max := 0
+	for dir := range p.only {
+		if count := p.activity[dir]; count > max {
+			hot, max = dir, count
+		}
+	}
+	return hot, max
+}
+
+// decay halves the counted changes, the recent changes count more than the old ones
+func (p *poller) decay() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	decayActivity(p.activity)
+}
+
+// decayActivity halves the counts of the directories and drops the ones which reach zero
+func decayActivity(activity map[string]int) {
+	for dir, count := range activity {
+		if count <= 1 {
+			delete(activity, dir)
+			continue
+		}
+		activity[dir] = count / 2
+	}
+}
+
+// list returns the entries of a directory, only the watched file is listed for a single file
+func (p *poller) list(dir string) (map[string]pollEntry, error) {
+	return p.listDir(dir, true)
+}
+
+// listDir returns the entries of a directory, the calls to the file system are throttled by the poll budget if set
+func (p *poller) listDir(dir string, throttled bool) (map[string]pollEntry, error) {
+	entries := make(map[string]pollEntry)
+	w := p.newWalker(dir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if path == dir || p.file && path != p.path {
+			return nil
+		}
+		if fileInfo.IsDir() && ignoreFolders[fileInfo.Name()] {
+			return filepath.SkipDir
+		}
+		entries[path] = pollEntry{info: fileutil.Info(fileInfo), isDir: fileInfo.IsDir()}
+		return nil
+	})
+	w.shallow = true
+	if throttled {
+		w.throttle = p.throttle
+	}
+	return entries, w.walk()
+}
+
+// throttle waits if the stat calls of the current second have used up the budget of the watch
+// or the global budget, it returns errPollStopped if the watch was stopped in the meantime
+func (p *poller) throttle() error {
+	if !p.limit.wait(p.stopped()) || !p.polls.wait(p.stopped()) {
+		return errPollStopped
+	}
+	return nil
+}
+
+// compare collects the differences between the previous and the current entries of a directory,
+// it returns true if the directory was changed
+func (p *poller) compare(changes *pollChanges, previous, entries map[string]pollEntry, created bool) bool {
+	changed := false
+	for path, entry := range entries {
+		changes.entries[path] = entry
+		old, ok := previous[path]
+		if !ok || created {
+			changes.added = append(changes.added, path)
+			changed = true
+			continue
+		}
+		if action, modified := compareEntries(old, entry); modified {
+			changes.modified[path] = action
+			changed = true
+		}
+	}
+	for path, entry := range previous {
+		if _, ok := entries[path]; !ok {
+			changes.previous[path] = entry
+			changes.removed = append(changes.removed, path)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// compareEntries returns the action for a file or directory which exists in both snapshots
+func compareEntries(old, entry pollEntry) (event.ActionType, bool) {
+	switch {
+	case !entry.isDir && old.info.Inode != entry.info.Inode:
+		return event.FileReplaced, true
+	case !entry.isDir && (old.info.Size != entry.info.Size || !old.info.ModTime.Equal(entry.info.ModTime)):
+		return event.FileModified, true
+	case old.info.Mode != entry.info.Mode || old.info.UID != entry.info.UID || old.info.GID != entry.info.GID:
+		return event.FileAttributesChanged, true
+	default:
+		return event.Invalid, false
+	}
+}
+
+// report sends the events of a poll, a removed and an added entry
+// with the same device and inode are reported as a rename
+func (p *poller) report(changes *pollChanges) {
+	sort.Strings(changes.removed)
+	sort.Strings(changes.added)
+
+	removed := make(map[fileKey]string)
+	for _, path := range changes.removed {
+		if info := changes.previous[path].info; info.Inode != 0 {
+			removed[fileKey{info.Device, info.Inode}] = path
+		}
+	}
+	renamed := make(map[string]string)
+	for _, path := range changes.added {
+		entry := changes.entries[path]
+		key := fileKey{entry.info.Device, entry.info.Inode}
+		if oldPath, ok := removed[key]; ok && entry.info.Inode != 0 && changes.previous[oldPath].isDir == entry.isDir {
+			renamed[path] = oldPath
+			delete(removed, key)
+		}
+	}
+	oldNames := make(map[string]bool)
+	for _, oldPath := range renamed {
+		oldNames[oldPath] = true
+	}
+
+	var removedDirs []string
+	for _, path := range changes.removed {
+		if oldNames[path] || insideOf(removedDirs, path) {
+			continue
+		}
+		if changes.previous[path].isDir {
+			removedDirs = append(removedDirs, path)
+			p.changed(path, event.DirRemoved, nil)
+			continue
+		}
+		p.changed(path, event.FileRemoved, nil)
+	}
+
+	var renamedDirs []string
+	for _, path := range changes.added {
+		if insideOf(renamedDirs, path) {
+			// moved with its directory
+			continue
+		}
+		entry := changes.entries[path]
+		info := entry.info
+		if oldPath, ok := renamed[path]; ok {
+			info.OldName = oldPath
+			if entry.isDir {
+				renamedDirs = append(renamedDirs, path)
+				p.changed(path, event.DirRenamed, &info)
+				continue
+			}
+			p.changed(path, event.FileRenamedNewName, &info)
+			continue
+		}
+		if entry.isDir {
+			p.changed(path, event.DirAdded, &info)
+			continue
+		}
+		action := event.FileAdded
+		if p.file {
+			// a single file is either added or replaced
+			action, _ = p.fileAction(path, action)
+		}
+		p.changed(path, action, &info)
+	}
+
+	for path, action := range changes.modified {
+		info := changes.entries[path].info
+		p.changed(path, action, &info)
+	}
+}
+
+// changed reports a change found by a poll
+func (p *poller) changed(path string, action event.ActionType, info *event.AdditionalInfo) {
+	p.touch(path)
+	p.fileChangeNotifier(path, action, info, nil)
+	switch {
+	case action == event.DirAdded && p.dirAdded != nil:
+		p.dirAdded(path)
+	case action == event.DirRenamed && p.dirRenamed != nil:
+		p.dirRenamed(info.OldName, path)
+	}
+}
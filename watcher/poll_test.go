@@ -0,0 +1,125 @@
+package watcher_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sevigo/notify/clock"
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+)
+
+func TestPolling(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "old.txt"), []byte("old"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "dir", "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "dir", "sub", "test.txt"), []byte("test"), 0o600))
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:      "poll",
+		PollInterval: time.Second,
+		PollBudget:   1000,
+		// the directories are not backed off
+		PollMaxInterval: time.Second,
+		Recursive:       true,
+		EventCh:         eventCh,
+		ErrorHandler:    func(event.Error) {},
+		Clock:           c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// poll fires the next poll once it's timed and the debouncing of the found changes
+	poll := func(count int) map[string]event.Event {
+		c.Advance(time.Second)
+		c.BlockUntil(1 + count)
+		c.Advance(time.Second)
+		return collectEvents(t, eventCh, count)
+	}
+
+	// the first poll is timed once the files are listed
+	c.BlockUntil(1)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "new.txt"), []byte("new"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "dir", "sub", "test.txt"), []byte("changed"), 0o600))
+	require.NoError(t, os.Rename(filepath.Join(root, "old.txt"), filepath.Join(root, "dir", "renamed.txt")))
+	events := poll(3)
+	assert.Equal(t, event.FileAdded, events["new.txt"].Action)
+	assert.Equal(t, event.FileModified, events[filepath.Join("dir", "sub", "test.txt")].Action)
+	// the renames are detected by the inode
+	assert.Equal(t, event.FileRenamedNewName, events[filepath.Join("dir", "renamed.txt")].Action)
+	assert.Equal(t, filepath.Join(root, "old.txt"), events[filepath.Join("dir", "renamed.txt")].OldName)
+
+	// the contents of a renamed or removed directory are not reported on their own
+	c.BlockUntil(1)
+	require.NoError(t, os.Rename(filepath.Join(root, "dir"), filepath.Join(root, "moved")))
+	require.NoError(t, os.Remove(filepath.Join(root, "new.txt")))
+	events = poll(2)
+	assert.Equal(t, event.DirRenamed, events["moved"].Action)
+	assert.Equal(t, event.FileRemoved, events["new.txt"].Action)
+}
+
+func TestPollingBackoff(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "hot"), 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "cold"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "cold", "test.txt"), []byte("test"), 0o600))
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewFake(start)
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:         "poll",
+		PollInterval:    time.Second,
+		PollMaxInterval: 4 * time.Second,
+		Recursive:       true,
+		EventCh:         eventCh,
+		ErrorHandler:    func(event.Error) {},
+		Clock:           c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// polls until the given second, the next poll is timed when the last one has ended
+	pollUntil := func(second int) {
+		for c.Now().Before(start.Add(time.Duration(second) * time.Second)) {
+			c.BlockUntil(1)
+			c.Advance(time.Second)
+		}
+		c.BlockUntil(1)
+	}
+
+	// the directories without changes are polled after 1, 2 and 4 seconds,
+	// a file created after the poll at 7s is found by the poll at 11s
+	pollUntil(7)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "hot", "1.txt"), []byte("1"), 0o600))
+	pollUntil(11)
+	// the poll and the debouncing of the event
+	c.BlockUntil(2)
+	c.Advance(time.Second)
+	e := <-eventCh
+	assert.Equal(t, event.FileAdded, e.Action)
+	assert.Equal(t, filepath.Join(root, "hot", "1.txt"), e.Path)
+	assert.Equal(t, start.Add(11*time.Second), e.DetectedAt)
+
+	// the changed directory is polled every second again and backed off from 12s on,
+	// a file moved out of a backed off directory is still reported as renamed
+	pollUntil(12)
+	require.NoError(t, os.Rename(filepath.Join(root, "cold", "test.txt"), filepath.Join(root, "hot", "test.txt")))
+	pollUntil(14)
+	c.BlockUntil(2)
+	c.Advance(time.Second)
+	e = <-eventCh
+	assert.Equal(t, event.FileRenamedNewName, e.Action)
+	assert.Equal(t, filepath.Join(root, "cold", "test.txt"), e.OldName)
+	assert.Equal(t, start.Add(14*time.Second), e.DetectedAt)
+}
@@ -0,0 +1,45 @@
+//go:build linux && !integration && !fake
+
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sevigo/notify/event"
+)
+
+// lookupProcess reads the executable, the command line and the real UID of a process from /proc,
+// the fields which can't be read are left empty, e.g. if the process has exited or belongs to another user
+func lookupProcess(pid int) *event.Process {
+	process := &event.Process{PID: pid}
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+		process.Exe = exe
+	}
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		// the arguments are terminated by a null byte
+		process.Cmdline = strings.Split(string(bytes.TrimRight(cmdline, "\x00")), "\x00")
+	}
+	if status, err := os.Open(filepath.Join(dir, "status")); err == nil {
+		defer status.Close()
+		scanner := bufio.NewScanner(status)
+		for scanner.Scan() {
+			// Uid: real, effective, saved set and file system UID
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || fields[0] != "Uid:" {
+				continue
+			}
+			if uid, err := strconv.ParseUint(fields[1], 10, 32); err == nil {
+				uid32 := uint32(uid)
+				process.UID = &uid32
+			}
+			break
+		}
+	}
+	return process
+}
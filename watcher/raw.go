@@ -0,0 +1,105 @@
+package watcher
+
+import (
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// InotifyRecord is the raw event reported by inotify on linux
+type InotifyRecord struct {
+	Wd     int
+	Mask   uint32
+	Cookie uint32
+	Name   string
+}
+
+var inotifyMaskNames = []struct {
+	mask uint32
+	name string
+}{
+	{0x00000001, "IN_ACCESS"},
+	{0x00000002, "IN_MODIFY"},
+	{0x00000004, "IN_ATTRIB"},
+	{0x00000008, "IN_CLOSE_WRITE"},
+	{0x00000010, "IN_CLOSE_NOWRITE"},
+	{0x00000020, "IN_OPEN"},
+	{0x00000040, "IN_MOVED_FROM"},
+	{0x00000080, "IN_MOVED_TO"},
+	{0x00000100, "IN_CREATE"},
+	{0x00000200, "IN_DELETE"},
+	{0x00000400, "IN_DELETE_SELF"},
+	{0x00000800, "IN_MOVE_SELF"},
+	{0x00002000, "IN_UNMOUNT"},
+	{0x00004000, "IN_Q_OVERFLOW"},
+	{0x00008000, "IN_IGNORED"},
+	{0x40000000, "IN_ISDIR"},
+}
+
+// MaskString returns the names of the bits set in the mask, e.g. "IN_CREATE|IN_ISDIR"
+func (r InotifyRecord) MaskString() string {
+	var names []string
+	for _, m := range inotifyMaskNames {
+		if r.Mask&m.mask != 0 {
+			names = append(names, m.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// FanotifyRecord is the raw event reported by fanotify on linux, Dir and Name are the
+// directory and the name of the changed entry, OldDir and OldName are set for a rename
+type FanotifyRecord struct {
+	Mask    uint64
+	Pid     int32
+	Dir     string
+	Name    string
+	OldDir  string
+	OldName string
+}
+
+var fanotifyMaskNames = []struct {
+	mask uint64
+	name string
+}{
+	{0x00000001, "FAN_ACCESS"},
+	{0x00000002, "FAN_MODIFY"},
+	{0x00000004, "FAN_ATTRIB"},
+	{0x00000008, "FAN_CLOSE_WRITE"},
+	{0x00000010, "FAN_CLOSE_NOWRITE"},
+	{0x00000020, "FAN_OPEN"},
+	{0x00000040, "FAN_MOVED_FROM"},
+	{0x00000080, "FAN_MOVED_TO"},
+	{0x00000100, "FAN_CREATE"},
+	{0x00000200, "FAN_DELETE"},
+	{0x00000400, "FAN_DELETE_SELF"},
+	{0x00000800, "FAN_MOVE_SELF"},
+	{0x00004000, "FAN_Q_OVERFLOW"},
+	{0x10000000, "FAN_RENAME"},
+	{0x40000000, "FAN_ONDIR"},
+}
+
+// MaskString returns the names of the bits set in the mask, e.g. "FAN_CREATE|FAN_ONDIR"
+func (r FanotifyRecord) MaskString() string {
+	var names []string
+	for _, m := range fanotifyMaskNames {
+		if r.Mask&m.mask != 0 {
+			names = append(names, m.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// FsnotifyRecord is the raw event reported by fsnotify
+type FsnotifyRecord struct {
+	Name string
+	Op   fsnotify.Op
+}
+
+// FakeRecord is the raw event reported by a FakeFS, Op is the operation which made the
+// change, e.g. "create", "write", "close" or "rename". OldPath is set for a rename
+type FakeRecord struct {
+	Op      string
+	Path    string
+	OldPath string
+}
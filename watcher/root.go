@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
+)
+
+// ErrRootLost is the error of a watch which was ended because its root
+// was deleted, moved away or unmounted
+var ErrRootLost = errors.New("the watched root was deleted, moved away or unmounted")
+
+// rootLost sends all pending events of the watch and reports the lost root
+func (wt *watch) rootLost(raw ...interface{}) {
+	if wt.output != nil {
+		wt.output(BackendEvent{Root: wt.path, Path: wt.path, Action: event.WatchRootLost, Raw: rawRecord(raw)})
+		return
+	}
+	wt.fileDebug("INFO", fmt.Sprintf("the watched root [%s] is lost", wt.path))
+	wt.waiter.Flush()
+	data := event.Event{
+		Path:         wt.path,
+		Action:       event.WatchRootLost,
+		Root:         wt.path,
+		RelativePath: wt.relativePath(wt.path),
+		DetectedAt:   wt.clock.Now(),
+	}
+	if wt.options.Raw {
+		data.Raw = raw
+	}
+	wt.waiter.Send(data)
+}
+
+// reconcile compares the root with the known state of the watch and
+// reports the files which were added, modified or removed in the meantime
+func (wt *watch) reconcile(known map[string]event.AdditionalInfo) {
+	wt.fileDebug("DEBUG", fmt.Sprintf("reconcile(): scanning the reappeared root [%s]", wt.path))
+	wt.walk(wt.path, func(absoluteFilePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			wt.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is excluded from watching because of an error: %v", absoluteFilePath, err))
+			return nil
+		}
+		if absoluteFilePath == wt.path && fileInfo.IsDir() {
+			return nil
+		}
+		if fileInfo.IsDir() && ignoreFolders[fileInfo.Name()] {
+			return filepath.SkipDir
+		}
+		info := fileutil.Info(fileInfo)
+		previous, ok := known[absoluteFilePath]
+		delete(known, absoluteFilePath)
+		switch {
+		case !ok && fileInfo.IsDir():
+			wt.fileChangeNotifier(absoluteFilePath, event.DirAdded, &info, nil)
+		case !ok:
+			wt.fileChangeNotifier(absoluteFilePath, event.FileAdded, &info, nil)
+		case !fileInfo.IsDir() && (info.Size != previous.Size || !info.ModTime.Equal(previous.ModTime) || info.Inode != previous.Inode):
+			wt.fileChangeNotifier(absoluteFilePath, event.FileModified, &info, nil)
+		}
+		if fileInfo.IsDir() && !wt.options.Recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	removed := make([]string, 0, len(known))
+	for path := range known {
+		if isSubPath(wt.path, path) && path != wt.path {
+			removed = append(removed, path)
+		}
+	}
+	// the parents are sorted before their contents, which are not reported separately
+	sort.Strings(removed)
+	var dirs []string
+	for _, path := range removed {
+		if insideOf(dirs, path) {
+			continue
+		}
+		if known[path].Mode.IsDir() {
+			dirs = append(dirs, path)
+			wt.fileChangeNotifier(path, event.DirRemoved, nil, nil)
+			continue
+		}
+		wt.fileChangeNotifier(path, event.FileRemoved, nil, nil)
+	}
+}
+
+func insideOf(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if isSubPath(dir, path) {
+			return true
+		}
+	}
+	return false
+}
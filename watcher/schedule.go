@@ -0,0 +1,98 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sevigo/notify/clock"
+)
+
+// pollBackoff is the default limit of the back-off, a directory without changes
+// is polled at least every pollBackoff intervals
+const pollBackoff = 32
+
+// pollSchedule is the poll interval of a single directory, it's reset to the interval
+// of the watch by a change and doubled by every poll without a change
+type pollSchedule struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// due returns true if the directory should be listed by the poll started at now,
+// the unknown directories are always due
+func (p *poller) due(dir string, now time.Time) bool {
+	if _, known := p.dirs[dir]; !known {
+		return true
+	}
+	schedule, ok := p.schedule[dir]
+	// the ticks are not exact, a directory due within half an interval is polled now
+	return !ok || !now.Add(p.interval/2).Before(schedule.next)
+}
+
+// reschedule sets the next poll of a directory after it was listed
+func (p *poller) reschedule(dir string, changed bool, now time.Time) {
+	schedule, ok := p.schedule[dir]
+	switch {
+	case !ok:
+		schedule = &pollSchedule{interval: p.interval}
+		p.schedule[dir] = schedule
+	case changed:
+		schedule.interval = p.interval
+	default:
+		schedule.interval *= 2
+		if schedule.interval > p.maxInterval {
+			schedule.interval = p.maxInterval
+		}
+	}
+	schedule.next = now.Add(schedule.interval)
+}
+
+// statLimiter limits the stat calls per second, it's shared by the polls of a watch
+// or of all watches. A nil limiter is unlimited
+type statLimiter struct {
+	clock  clock.Clock
+	mu     sync.Mutex
+	budget int
+	stats  int
+	second time.Time
+}
+
+// newStatLimiter returns the limiter of a budget, the real clock is used if c is nil
+func newStatLimiter(budget int, c clock.Clock) *statLimiter {
+	if budget <= 0 {
+		return nil
+	}
+	if c == nil {
+		c = clock.Real
+	}
+	return &statLimiter{clock: c, budget: budget}
+}
+
+// wait waits if the stat calls of the current second have used up the budget,
+// it returns false if stop was closed in the meantime
+func (l *statLimiter) wait(stop <-chan struct{}) bool {
+	if l == nil {
+		return true
+	}
+	for {
+		l.mu.Lock()
+		now := l.clock.Now()
+		if now.Sub(l.second) >= time.Second {
+			l.second = now
+			l.stats = 0
+		}
+		if l.stats < l.budget {
+			l.stats++
+			l.mu.Unlock()
+			return true
+		}
+		delay := l.second.Add(time.Second).Sub(now)
+		l.mu.Unlock()
+
+		select {
+		case <-l.clock.After(delay):
+		case <-stop:
+			return false
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package watcher_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sevigo/notify"
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+)
+
+var directoryWatcher core.DirectoryWatcher
+
+func init() {
+	directoryWatcher = notify.Setup(context.TODO(), nil)
+	go func() {
+		for err := range directoryWatcher.Error() {
+			fmt.Printf("[%s] %q\n", err.Level, err.Message)
+
+		}
+	}()
+}
+
+// collectEvents reads from the channel until count events are received
+func collectEvents(t *testing.T, ch chan event.Event, count int) map[string]event.Event {
+	t.Helper()
+	events := make(map[string]event.Event)
+	timeout := time.After(5 * time.Second)
+	for len(events) < count {
+		select {
+		case e := <-ch:
+			events[e.RelativePath] = e
+		case <-timeout:
+			t.Fatalf("got %d events, want %d: %v", len(events), count, events)
+		}
+	}
+	return events
+}
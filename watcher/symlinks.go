@@ -0,0 +1,161 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
+)
+
+// symlinkTarget is the resolved target of a symlink and the checksum of its content
+type symlinkTarget struct {
+	target   string
+	checksum string
+}
+
+// symlinkCache remembers the targets of the symlinks of a watch,
+// it's used to report the files which were changed by swapping a link
+type symlinkCache struct {
+	mu    sync.Mutex
+	links map[string]symlinkTarget
+	// changed are the paths changed since the last update, running is set while it's updated
+	changed map[string]bool
+	running bool
+}
+
+// isSwapAction returns true if the action can change the target of a symlink
+func isSwapAction(action event.ActionType) bool {
+	switch action {
+	case event.FileAdded, event.FileRenamedNewName, event.FileReplaced, event.DirAdded, event.DirRenamed:
+		return true
+	default:
+		return false
+	}
+}
+
+// resolveSymlinks resolves all symlinks of the watch which point to a file
+func (wt *watch) resolveSymlinks() {
+	links := make(map[string]symlinkTarget)
+	wt.findSymlinks(wt.path, links)
+	wt.symlinks.mu.Lock()
+	wt.symlinks.links = links
+	wt.symlinks.mu.Unlock()
+}
+
+// symlinkChanged updates the symlinks after a change which can swap a link. The update runs in
+// its own goroutine and takes the changes along which are reported in the meantime
+func (wt *watch) symlinkChanged(path string, action event.ActionType) {
+	if !wt.options.ResolveSymlinks || !isSwapAction(action) {
+		return
+	}
+	c := &wt.symlinks
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.changed == nil {
+		c.changed = make(map[string]bool)
+	}
+	c.changed[path] = true
+	if !c.running {
+		c.running = true
+		go wt.updateSymlinks()
+	}
+}
+
+// updateSymlinks resolves the links below the changed paths and the known links again. FileModified
+// is sent for each link whose target content differs from the last time, e.g. after the ..data link
+// of a mounted ConfigMap was swapped to a new directory. The content of a known link is only read
+// again if it points to another file now
+func (wt *watch) updateSymlinks() {
+	c := &wt.symlinks
+	for {
+		c.mu.Lock()
+		changed, previous := c.changed, c.links
+		c.changed = nil
+		if len(changed) == 0 {
+			c.running = false
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+
+		links := make(map[string]symlinkTarget, len(previous))
+		for path := range changed {
+			if isSubPath(wt.path, path) {
+				wt.findSymlinks(path, links)
+			}
+		}
+		for path, known := range previous {
+			if _, ok := links[path]; ok {
+				continue
+			}
+			target, err := filepath.EvalSymlinks(path)
+			switch {
+			case err != nil || target == path:
+				// the link is gone
+			case target == known.target:
+				links[path] = known
+			default:
+				if link, ok := resolveSymlink(path); ok {
+					links[path] = link
+				}
+			}
+		}
+
+		c.mu.Lock()
+		c.links = links
+		c.mu.Unlock()
+		for path, link := range links {
+			if known, ok := previous[path]; ok && known.checksum != link.checksum {
+				wt.fileChangeNotifier(path, event.FileModified, nil, nil)
+			}
+		}
+	}
+}
+
+// findSymlinks adds the symlinks to files below root to links, the tree is walked
+// with the SymlinkPolicy and the file system options of the watch
+func (wt *watch) findSymlinks(root string, links map[string]symlinkTarget) {
+	wt.walk(root, func(absoluteFilePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if fileInfo.IsDir() {
+			if absoluteFilePath != wt.path && (!wt.options.Recursive || ignoreFolders[fileInfo.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if wt.options.SymlinkPolicy == core.SymlinkFollow {
+			// the walk passes the target of a followed link
+			if fileInfo, err = os.Lstat(absoluteFilePath); err != nil {
+				return nil
+			}
+		}
+		if fileInfo.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		if link, ok := resolveSymlink(absoluteFilePath); ok {
+			links[absoluteFilePath] = link
+		}
+		return nil
+	})
+}
+
+// resolveSymlink returns the target of a symlink to a regular file and the checksum of its content
+func resolveSymlink(path string) (symlinkTarget, bool) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return symlinkTarget{}, false
+	}
+	if info, err := os.Stat(target); err != nil || !info.Mode().IsRegular() {
+		return symlinkTarget{}, false
+	}
+	checksum, err := fileutil.Checksum(target)
+	if err != nil {
+		return symlinkTarget{}, false
+	}
+	return symlinkTarget{target: target, checksum: checksum}, true
+}
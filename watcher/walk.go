@@ -0,0 +1,251 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/fileutil"
+)
+
+// walk walks the tree of root like filepath.Walk, but handles the symlinks with the
+// SymlinkPolicy of the watch. With SymlinkFollow the linked directories are visited
+// with the path of the link, a directory is only visited once to break link loops.
+// The directories on other or excluded file systems are skipped as the options require
+func (wt *watch) walk(root string, fn filepath.WalkFunc) error {
+	return wt.newWalker(root, fn).walk()
+}
+
+func (wt *watch) newWalker(root string, fn filepath.WalkFunc) *walker {
+	return &walker{
+		watch:   wt,
+		root:    root,
+		visited: make(map[string]bool),
+		fn:      fn,
+	}
+}
+
+// walker holds the state of a single walk
+type walker struct {
+	*watch
+	root string
+	// device is the device of the watched path
+	device  uint64
+	visited map[string]bool
+	fn      filepath.WalkFunc
+	// shallow doesn't read the sub-directories of root
+	shallow bool
+	// throttle is called before every call to the file system, the walk ends with its error
+	throttle func() error
+}
+
+func (w *walker) walk() error {
+	if err := w.wait(); err != nil {
+		return err
+	}
+	info, err := os.Lstat(w.root)
+	if err != nil {
+		err = w.fn(w.root, nil, err)
+	} else if err = w.watchedDevice(info); err == nil {
+		err = w.walkPath(w.root, info, w.device)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// wait calls the throttle of the walk if it has one
+func (w *walker) wait() error {
+	if w.throttle == nil {
+		return nil
+	}
+	return w.throttle()
+}
+
+// watchedDevice sets the device of the watched path, it's read again
+// unless the walk starts at the watched path itself
+func (w *walker) watchedDevice(rootInfo os.FileInfo) error {
+	if w.root == w.path && rootInfo.Mode()&os.ModeSymlink == 0 {
+		w.device = fileutil.Info(rootInfo).Device
+		return nil
+	}
+	if err := w.wait(); err != nil {
+		return err
+	}
+	if watched, err := os.Stat(w.path); err == nil {
+		w.device = fileutil.Info(watched).Device
+	}
+	return nil
+}
+
+func (w *walker) walkPath(path string, info os.FileInfo, parentDevice uint64) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		switch w.options.SymlinkPolicy {
+		case core.SymlinkIgnore:
+			return nil
+		case core.SymlinkFollow:
+			if err := w.wait(); err != nil {
+				return err
+			}
+			// a dangling link is reported itself
+			if target, err := os.Stat(path); err == nil {
+				info = target
+			}
+		}
+	}
+	if !info.IsDir() {
+		return w.fn(path, info, nil)
+	}
+
+	device := fileutil.Info(info).Device
+	if device != parentDevice && !w.sameFileSystem(path, device) {
+		return nil
+	}
+	key, err := w.dirKey(path, info)
+	if err != nil {
+		return err
+	}
+	if w.visited[key] {
+		w.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is skipped, it was already visited", path))
+		return nil
+	}
+	w.visited[key] = true
+	if w.shallow && path != w.root {
+		if err := w.fn(path, info, nil); err != filepath.SkipDir {
+			return err
+		}
+		return nil
+	}
+
+	if err := w.wait(); err != nil {
+		return err
+	}
+	names, readErr := readDirNames(path)
+	if err := w.fn(path, info, readErr); err != nil || readErr != nil {
+		// the directory can't be read or is skipped by fn
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	// the links are visited last, a directory reachable by its own path is not visited through a link
+	children := make([]walkEntry, 0, len(names))
+	var links []walkEntry
+	for _, name := range names {
+		if err := w.wait(); err != nil {
+			return err
+		}
+		child := filepath.Join(path, name)
+		childInfo, err := os.Lstat(child)
+		if err == nil && childInfo.Mode()&os.ModeSymlink != 0 {
+			links = append(links, walkEntry{child, childInfo, nil})
+		} else {
+			children = append(children, walkEntry{child, childInfo, err})
+		}
+	}
+	for _, child := range append(children, links...) {
+		if child.err != nil {
+			// like filepath.Walk, SkipDir for an entry which can't be read skips only the entry
+			if err := w.fn(child.path, child.info, child.err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		err := w.walkPath(child.path, child.info, device)
+		if err == filepath.SkipDir {
+			// a file has skipped the rest of the directory
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkEntry is an entry of a directory with the result of its Lstat
+type walkEntry struct {
+	path string
+	info os.FileInfo
+	err  error
+}
+
+// sameFileSystem returns false if the directory at a mount point has to be skipped
+func (w *walker) sameFileSystem(path string, device uint64) bool {
+	if w.options.OneFileSystem && device != w.device {
+		w.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is skipped, it's on another file system", path))
+		return false
+	}
+	if len(w.options.ExcludeFSTypes) == 0 {
+		return true
+	}
+	if w.wait() != nil {
+		// the walk ends with the next call
+		return true
+	}
+	fsType, err := fileutil.FSType(path)
+	if err != nil {
+		return true
+	}
+	for _, excluded := range w.options.ExcludeFSTypes {
+		if fsType == excluded {
+			w.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is skipped, its file system type is %s", path, fsType))
+			return false
+		}
+	}
+	return true
+}
+
+// isFollowedDir returns true if the path is a symlink to a directory and the links are followed
+func (wt *watch) isFollowedDir(path string) bool {
+	if wt.options.SymlinkPolicy != core.SymlinkFollow {
+		return false
+	}
+	if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// isIgnoredSymlink returns true if the path is a symlink and the links are ignored
+func (wt *watch) isIgnoredSymlink(path string) bool {
+	if wt.options.SymlinkPolicy != core.SymlinkIgnore || path == wt.path {
+		return false
+	}
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// dirKey identifies a directory by device and inode, the resolved path
+// is used if the file system doesn't provide them
+func (w *walker) dirKey(path string, info os.FileInfo) (string, error) {
+	stat := fileutil.Info(info)
+	if stat.Inode != 0 {
+		return fmt.Sprintf("%d:%d", stat.Device, stat.Inode), nil
+	}
+	if err := w.wait(); err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved, nil
+	}
+	return path, nil
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,282 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sevigo/notify/clock"
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+)
+
+// watch is the handle returned by StartWatching, every backend
+// ends a watch by calling finish()
+type watch struct {
+	path    string
+	options core.WatchingOptions
+	// file is true if a single file is watched, the backends watch its directory then
+	file bool
+
+	// parent is the context passed to StartWatching, ctx is cancelled by Stop() as well
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// clock runs all timers of the watch
+	clock clock.Clock
+	// fs is read to check the root and to scan it
+	fs fileSystem
+	// waiter holds the pending notifications of this watch only
+	waiter *event.Waiter
+	// attributes are used to report the changed attributes of a file
+	attributes attributeCache
+	// symlinks are used to report the files changed by a swapped symlink
+	symlinks symlinkCache
+	// polls is the budget of stat calls shared by all polled watches
+	polls *statLimiter
+	// events and errors are either the shared channels or the ones from the options
+	events chan event.Event
+	errors chan event.Error
+	// output receives the changes and the messages of a watch run by a Backend instead of
+	// the waiter and the channels, consumer is the watch of the DirectoryWatcher which uses it
+	output   func(BackendEvent)
+	consumer *watch
+
+	done     chan struct{}
+	doneOnce sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+func newWatch(ctx context.Context, path string, options *core.WatchingOptions) *watch {
+	wt := &watch{
+		path:    path,
+		options: *options,
+		clock:   options.Clock,
+		fs:      osFileSystem{},
+		parent:  ctx,
+		done:    make(chan struct{}),
+	}
+	if wt.clock == nil {
+		wt.clock = clock.Real
+	}
+	wt.ctx, wt.cancel = context.WithCancel(ctx)
+	return wt
+}
+
+// Stop signals the backend to stop and waits until the watch is ended
+func (wt *watch) Stop() {
+	wt.cancel()
+	<-wt.done
+}
+
+// Done is closed when the watch is ended
+func (wt *watch) Done() <-chan struct{} {
+	return wt.done
+}
+
+// Err returns the reason why the watch was ended
+func (wt *watch) Err() error {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	return wt.err
+}
+
+// Path returns the watched path
+func (wt *watch) Path() string {
+	return wt.path
+}
+
+// Options returns the options the watch was started with
+func (wt *watch) Options() core.WatchingOptions {
+	return wt.options
+}
+
+// setOutput selects the channels for the events and errors of the watch,
+// the shared channels are used if the options don't provide any
+func (wt *watch) setOutput(events chan event.Event, errors chan event.Error) {
+	wt.events = events
+	if wt.options.EventCh != nil {
+		wt.events = wt.options.EventCh
+	}
+	if handler := wt.options.EventHandler; handler != nil {
+		wt.events = make(chan event.Event)
+		go func(ch chan event.Event) {
+			for {
+				select {
+				case e := <-ch:
+					handler(e)
+				case <-wt.done:
+					return
+				}
+			}
+		}(wt.events)
+	}
+
+	wt.errors = errors
+	if wt.options.ErrorCh != nil {
+		wt.errors = wt.options.ErrorCh
+	}
+	if handler := wt.options.ErrorHandler; handler != nil {
+		wt.errors = make(chan event.Error)
+		go func(ch chan event.Error) {
+			for {
+				select {
+				case e := <-ch:
+					handler(e)
+				case <-wt.done:
+					return
+				}
+			}
+		}(wt.errors)
+	}
+}
+
+// fileError reports an error of the watch while it's running
+func (wt *watch) fileError(lvl string, err error) {
+	wt.sendError(event.FormatError(lvl, err.Error()))
+}
+
+// fileDebug reports a message of the watch while it's running
+func (wt *watch) fileDebug(lvl string, msg string) {
+	wt.sendError(event.FormatError(lvl, msg))
+}
+
+func (wt *watch) sendError(e event.Error) {
+	if wt.output != nil {
+		wt.output(BackendEvent{Root: wt.path, Message: &e})
+		return
+	}
+	select {
+	case wt.errors <- e:
+	case <-wt.ctx.Done():
+	}
+}
+
+// detectFile checks if the watched path is a single file
+func (wt *watch) detectFile() {
+	info, err := wt.fs.stat(wt.path)
+	wt.file = err == nil && !info.IsDir()
+}
+
+// watchedDir returns the directory the backend has to watch
+func (wt *watch) watchedDir() string {
+	if wt.file {
+		return filepath.Dir(wt.path)
+	}
+	return wt.path
+}
+
+// fileAction maps the action of an entry in the directory of a watched file,
+// it returns false for the other entries of the directory
+func (wt *watch) fileAction(absoluteFilePath string, action event.ActionType) (event.ActionType, bool) {
+	if absoluteFilePath != wt.path {
+		// the symlinks are resolved by the consumer of a backend
+		if wt.consumer != nil {
+			wt.consumer.symlinkChanged(absoluteFilePath, action)
+		} else {
+			wt.symlinkChanged(absoluteFilePath, action)
+		}
+		return action, false
+	}
+	switch action {
+	case event.FileAdded, event.FileRenamedNewName:
+		// a file renamed over the watched one replaces it without removing it first
+		if wt.attributes.has(wt.path) {
+			return event.FileReplaced, true
+		}
+		return event.FileAdded, true
+	case event.FileRenamedOldName:
+		return event.FileRemoved, true
+	case event.FileModified, event.FileRemoved, event.FileAttributesChanged,
+		event.FileOpened, event.FileAccessed, event.FileClosedNoWrite:
+		return action, true
+	default:
+		return action, false
+	}
+}
+
+// relativePath returns the path relative to the watched root
+func (wt *watch) relativePath(absoluteFilePath string) string {
+	rel, err := filepath.Rel(wt.path, absoluteFilePath)
+	if err != nil {
+		return absoluteFilePath
+	}
+	return rel
+}
+
+// isSubPath returns true if path is root or inside of root
+func isSubPath(root, path string) bool {
+	if path == root {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// stopped is closed when Stop() was called or the context of the watch is done
+func (wt *watch) stopped() <-chan struct{} {
+	return wt.ctx.Done()
+}
+
+// finish ends the watch with an optional error, it is safe to call it more than once.
+// Without an error the watch reports the error of its context, if there is any.
+// The end of a watch run by a Backend is reported by its consumer
+func (wt *watch) finish(err error) {
+	wt.doneOnce.Do(func() {
+		if wt.output == nil {
+			wt.fileDebug("INFO", fmt.Sprintf("[%s] is not watched anymore", wt.path))
+		}
+		if err == nil {
+			err = wt.parent.Err()
+		}
+		wt.cancel()
+		wt.mu.Lock()
+		wt.err = err
+		wt.mu.Unlock()
+		unregisterWatch(wt)
+		close(wt.done)
+	})
+}
+
+var watchesMutex sync.Mutex
+var watches = make(map[string]*watch)
+
+func registerWatch(wt *watch) bool {
+	watchesMutex.Lock()
+	defer watchesMutex.Unlock()
+	if _, found := watches[wt.path]; found {
+		return false
+	}
+	watches[wt.path] = wt
+	return true
+}
+
+func unregisterWatch(wt *watch) {
+	watchesMutex.Lock()
+	defer watchesMutex.Unlock()
+	if watches[wt.path] == wt {
+		delete(watches, wt.path)
+	}
+}
+
+func lookupWatch(path string) (*watch, bool) {
+	watchesMutex.Lock()
+	defer watchesMutex.Unlock()
+	wt, ok := watches[path]
+	return wt, ok
+}
+
+// activeWatches returns a snapshot of all registered watches
+func activeWatches() []*watch {
+	watchesMutex.Lock()
+	defer watchesMutex.Unlock()
+	list := make([]*watch, 0, len(watches))
+	for _, wt := range watches {
+		list = append(list, wt)
+	}
+	return list
+}
@@ -8,7 +8,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/sevigo/notify/clock"
+	"github.com/sevigo/notify/core"
 	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
 )
 
 // ActionToString maps Action value to string
@@ -24,6 +27,24 @@ func ActionToString(action event.ActionType) string {
 		return "renamedFrom"
 	case event.FileRenamedNewName:
 		return "renamedTo"
+	case event.DirAdded:
+		return "dirAdded"
+	case event.DirRemoved:
+		return "dirRemoved"
+	case event.DirRenamed:
+		return "dirRenamed"
+	case event.FileAttributesChanged:
+		return "attributesChanged"
+	case event.FileOpened:
+		return "opened"
+	case event.FileAccessed:
+		return "accessed"
+	case event.FileClosedNoWrite:
+		return "closedNoWrite"
+	case event.WatchRootLost:
+		return "rootLost"
+	case event.FileReplaced:
+		return "replaced"
 	default:
 		return "invalid"
 	}
@@ -34,59 +55,50 @@ func ActionToString(action event.ActionType) string {
 type DirectoryWatcher struct {
 	events chan event.Event
 	errors chan event.Error
+	// sequence is shared by all watches
+	sequence event.Sequence
+	// polls limits the stat calls of all polled watches
+	polls *statLimiter
+	// backend is the name of the backend used by the watches which don't select one
+	backend string
 
 	event.Waiter
 }
 
 // Options represents global options for the notify
 type Options struct {
-}
-
-// Callback holds information about watcher channels
-type Callback struct {
-	Stop  bool
-	Pause bool
+	// Backend is the name of the backend used by all watches which don't select one,
+	// the default backend of the OS is used if it's empty
+	Backend string
+	// PollBudget limits the stat calls per second of all polled watches together, unlimited by default
+	PollBudget int
+	// Clock runs the timers of all watches which don't select one, the real clock is used by default.
+	// With a clock.Fake the tests control the timing without sleeping
+	Clock clock.Clock
 }
 
 var watcher *DirectoryWatcher
 var once sync.Once
 
-var watchersCallbackMutex sync.Mutex
-var watchersCallback = make(map[string]chan Callback)
-
-func RegisterCallback(path string) chan Callback {
-	watchersCallbackMutex.Lock()
-	defer watchersCallbackMutex.Unlock()
-	cb := make(chan Callback)
-	watchersCallback[path] = cb
-	return cb
-}
-
-func UnregisterCallback(path string) {
-	watchersCallbackMutex.Lock()
-	defer watchersCallbackMutex.Unlock()
-	delete(watchersCallback, path)
-}
-
-func LookupForCallback(path string) (chan Callback, bool) {
-	watchersCallbackMutex.Lock()
-	defer watchersCallbackMutex.Unlock()
-	data, ok := watchersCallback[path]
-	return data, ok
-}
-
 // Create new global instance of file watcher
 func Create(ctx context.Context, callbackCh chan event.Event, errorCh chan event.Error, options *Options) *DirectoryWatcher {
 	once.Do(func() {
 		go processContext(ctx)
+		if options == nil {
+			options = &Options{}
+		}
 		watcher = &DirectoryWatcher{
-			events: callbackCh,
-			errors: errorCh,
+			events:  callbackCh,
+			errors:  errorCh,
+			polls:   newStatLimiter(options.PollBudget, options.Clock),
+			backend: options.Backend,
 
 			Waiter: event.Waiter{
 				EventCh:  callbackCh,
+				ErrorCh:  errorCh,
 				Timeout:  1 * time.Second,
 				MaxCount: 5,
+				Clock:    options.Clock,
 			},
 		}
 	})
@@ -101,30 +113,33 @@ func (w *DirectoryWatcher) Error() chan event.Error {
 	return w.errors
 }
 
-func (w *DirectoryWatcher) scan(path string) error {
-	path = filepath.Clean(path)
-	fileDebug("DEBUG", fmt.Sprintf("scan(): starting recursive scanning from root [%q]", path))
-	return filepath.Walk(path, func(absoluteFilePath string, fileInfo os.FileInfo, err error) error {
-		if fileInfo.IsDir() {
+// scan reports all files and directories below root as added, a file root is reported itself
+func (wt *watch) scan(root string) error {
+	wt.fileDebug("DEBUG", fmt.Sprintf("scan(): starting recursive scanning from root [%q]", root))
+	return wt.fs.walk(wt, root, func(absoluteFilePath string, fileInfo os.FileInfo, err error) error {
+		if fileInfo != nil && fileInfo.IsDir() {
 			dir := fileInfo.Name()
 			if ignoreFolders[dir] {
-				fileDebug("DEBUG", fmt.Sprintf("dir [%s] is excluded from watching", absoluteFilePath))
+				wt.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is excluded from watching", absoluteFilePath))
 				return filepath.SkipDir
 			}
 			if os.IsPermission(err) {
-				fileDebug("DEBUG", fmt.Sprintf("dir [%s] is excluded from watching because of an error: %v", absoluteFilePath, err))
+				wt.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is excluded from watching because of an error: %v", absoluteFilePath, err))
 				return filepath.SkipDir
 			}
 		}
 		if err != nil {
-			fileError("ERROR", fmt.Errorf("can't scan [%s]: %v", path, err))
+			wt.fileError("ERROR", fmt.Errorf("can't scan [%s]: %v", root, err))
 			return filepath.SkipDir
 		}
-		if !fileInfo.IsDir() {
-			fileChangeNotifier(absoluteFilePath, event.FileAdded, &event.AdditionalInfo{
-				Size:    fileInfo.Size(),
-				ModTime: fileInfo.ModTime(),
-			})
+		if absoluteFilePath == root && fileInfo.IsDir() {
+			return nil
+		}
+		info := entryInfo(fileInfo)
+		if fileInfo.IsDir() {
+			wt.fileChangeNotifier(absoluteFilePath, event.DirAdded, &info, nil)
+		} else {
+			wt.fileChangeNotifier(absoluteFilePath, event.FileAdded, &info, nil)
 		}
 		return nil
 	})
@@ -132,41 +147,110 @@ func (w *DirectoryWatcher) scan(path string) error {
 
 func (w *DirectoryWatcher) RescanAll() {
 	fileDebug("DEBUG", "RescanAll(): event triggerd")
-	for path := range watchersCallback {
-		err := w.scan(path)
+	for _, wt := range activeWatches() {
+		err := wt.scan(wt.path)
 		if err != nil {
-			fileError("CRITICAL", fmt.Errorf("cannot scan directory [%s]", path))
+			wt.fileError("CRITICAL", fmt.Errorf("cannot scan directory [%s]", wt.path))
 		}
 	}
 }
 
+// StartWatching starts watching the path in the background. An error is returned
+// if the path can't be watched, otherwise the watch is running until it is stopped
+// or the context is done
+func (w *DirectoryWatcher) StartWatching(ctx context.Context, path string, options *core.WatchingOptions) (core.Watch, error) {
+	if options == nil {
+		options = &core.WatchingOptions{}
+	}
+	path = filepath.Clean(path)
+	wt := newWatch(ctx, path, options)
+	wt.setOutput(w.events, w.errors)
+	wt.polls = w.polls
+	if options.Clock == nil && w.Clock != nil {
+		wt.clock = w.Clock
+	}
+	wt.waiter = &event.Waiter{
+		EventCh:  wt.events,
+		ErrorCh:  wt.errors,
+		Timeout:  w.Timeout,
+		MaxCount: w.MaxCount,
+		Done:     wt.ctx.Done(),
+		Sequence: &w.sequence,
+		Clock:    wt.clock,
+	}
+	wt.fs = backendFileSystem(w.backendName(*options))
+	if !registerWatch(wt) {
+		return nil, fmt.Errorf("[%s] is already watched", path)
+	}
+
+	if _, err := wt.fs.stat(path); os.IsNotExist(err) && options.WaitForCreation {
+		go w.startWhenCreated(wt)
+		return wt, nil
+	}
+	wt.detectFile()
+	if err := w.start(wt); err != nil {
+		unregisterWatch(wt)
+		return nil, err
+	}
+	if options.ResolveSymlinks {
+		wt.resolveSymlinks()
+	}
+
+	go func() {
+		wt.fileDebug("INFO", fmt.Sprintf("start watching [%s]", path))
+		if options.Rescan {
+			if err := wt.scan(path); err != nil {
+				wt.fileError("CRITICAL", fmt.Errorf("can't scan [%s]: %v", path, err))
+			}
+		}
+	}()
+	return wt, nil
+}
+
+// startWhenCreated starts the backend of the watch as soon as its path
+// is created and reports everything the path contains by then
+func (w *DirectoryWatcher) startWhenCreated(wt *watch) {
+	wt.fileDebug("INFO", fmt.Sprintf("waiting for [%s] to be created", wt.path))
+	if !wt.fs.waitForCreation(wt) {
+		wt.finish(nil)
+		return
+	}
+	wt.detectFile()
+	if err := w.start(wt); err != nil {
+		wt.fileError("CRITICAL", err)
+		wt.finish(err)
+		return
+	}
+	if wt.options.ResolveSymlinks {
+		wt.resolveSymlinks()
+	}
+	wt.fileDebug("INFO", fmt.Sprintf("start watching [%s]", wt.path))
+	if err := wt.scan(wt.path); err != nil {
+		wt.fileError("CRITICAL", fmt.Errorf("can't scan [%s]: %v", wt.path, err))
+	}
+}
+
 func processContext(ctx context.Context) {
 	<-ctx.Done()
-	watchersCallbackMutex.Lock()
-	defer watchersCallbackMutex.Unlock()
-	for _, ch := range watchersCallback {
-		ch <- Callback{
-			Stop: true,
-		}
+	for _, wt := range activeWatches() {
+		wt.Stop()
 	}
 }
 
-// StopWatching sends a signal to stop watching a directory
+// StopWatching stops watching a path started with StartWatching
 func (w *DirectoryWatcher) StopWatching(watchDirectoryPath string) {
-	ch, ok := LookupForCallback(watchDirectoryPath)
+	wt, ok := lookupWatch(filepath.Clean(watchDirectoryPath))
 	if ok {
-		ch <- Callback{
-			Stop:  true,
-			Pause: false,
-		}
-		UnregisterCallback(watchDirectoryPath)
+		wt.Stop()
 	}
 }
 
-func fileError(lvl string, err error) {
-	// TODO: we can print to STDOUT here if this is globaly configured
-	// fmt.Printf("fileDebug(): [%s] %s\n", lvl, msg)
-	watcher.errors <- event.FormatError(lvl, err.Error())
+// checkWatchable returns an error if the path doesn't exist
+func checkWatchable(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("cannot start watching [%s]: %v", path, err)
+	}
+	return nil
 }
 
 func fileDebug(lvl string, msg string) {
@@ -175,26 +259,84 @@ func fileDebug(lvl string, msg string) {
 	watcher.errors <- event.FormatError(lvl, msg)
 }
 
-func fileChangeNotifier(absoluteFilePath string, action event.ActionType, info *event.AdditionalInfo) {
-	fileDebug("DEBUG", fmt.Sprintf("file [%s], action [%s]", absoluteFilePath, ActionToString(action)))
+func isReadAction(action event.ActionType) bool {
+	return action == event.FileOpened || action == event.FileAccessed || action == event.FileClosedNoWrite
+}
+
+// metadata returns the file metadata for the event, it's read from the file system
+// if the backend has not provided it. Removed files have no metadata.
+func metadata(absoluteFilePath string, action event.ActionType, info *event.AdditionalInfo) *event.AdditionalInfo {
+	if action == event.FileRemoved || action == event.FileRenamedOldName || action == event.DirRemoved {
+		return info
+	}
+	if info != nil && !info.ModTime.IsZero() {
+		return info
+	}
+	stat, err := fileutil.Stat(absoluteFilePath)
+	if err != nil {
+		// the file is already gone
+		return info
+	}
+	if info != nil {
+		stat.OldName = info.OldName
+	}
+	return stat
+}
+
+// fileChangeNotifier reports a change of the watch, the records of the backend are only added
+// to the event in the raw mode. The process is set by the backends which report it
+func (wt *watch) fileChangeNotifier(absoluteFilePath string, action event.ActionType, info *event.AdditionalInfo, process *event.Process, raw ...interface{}) {
+	e := BackendEvent{Path: absoluteFilePath, Action: action, Info: info, Process: process}
+	if wt.output != nil {
+		wt.emit(e, raw)
+		return
+	}
+	wt.notifyChange(e, raw)
+}
+
+// notifyChange debounces a change of the watch, the changed attributes
+// are taken from the backend if it has reported them
+func (wt *watch) notifyChange(e BackendEvent, raw []interface{}) {
+	absoluteFilePath, action, info := e.Path, e.Action, e.Info
+	if wt.isIgnoredSymlink(absoluteFilePath) {
+		return
+	}
+	wt.fileDebug("DEBUG", fmt.Sprintf("file [%s], action [%s]", absoluteFilePath, ActionToString(action)))
 	// notification event is registered for this path, wait for 5 secs
 	data := &event.Event{
-		Path:   absoluteFilePath,
-		Action: action,
+		Path:         absoluteFilePath,
+		Action:       action,
+		Root:         wt.path,
+		RelativePath: wt.relativePath(absoluteFilePath),
+		DetectedAt:   wt.clock.Now(),
+		Process:      e.Process,
 	}
+	if wt.options.Raw {
+		data.Raw = raw
+	}
+	wt.symlinkChanged(absoluteFilePath, action)
 
 	fileNotificationKey := absoluteFilePath
-	wait, exists := watcher.LookupForFileNotification(fileNotificationKey)
-	if exists {
-		wait <- *data
+	if isReadAction(action) {
+		// read events are not merged with the changes of the file
+		fileNotificationKey += "\x00" + ActionToString(action)
+	}
+	// the metadata is read for the merged changes as well, the event reports the last one
+	if info = metadata(absoluteFilePath, action, info); info != nil {
+		data.AdditionalInfo = *info
+	}
+	if wt.waiter.Notify(fileNotificationKey, *data) {
+		wt.attributes.update(absoluteFilePath, action, info)
 		return
 	}
-	watcher.RegisterFileNotification(fileNotificationKey)
-	if info != nil {
-		data.Size = info.Size
-		data.ModTime = info.ModTime
-		data.OldName = info.OldName
+	wt.waiter.RegisterFileNotification(fileNotificationKey)
+	if action == event.FileAttributesChanged {
+		data.ChangedAttributes = e.ChangedAttributes
+		if data.ChangedAttributes == 0 {
+			data.ChangedAttributes = wt.attributes.changes(absoluteFilePath, info)
+		}
 	}
+	wt.attributes.update(absoluteFilePath, action, info)
 
-	go watcher.Wait(fileNotificationKey, data)
+	go wt.waiter.Wait(fileNotificationKey, data)
 }
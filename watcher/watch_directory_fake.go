@@ -1,17 +1,21 @@
+//go:build fake
 // +build fake
 
 package watcher
 
-import (
-	"time"
+var ignoreFolders = map[string]bool{}
 
-	"github.com/sevigo/notify/core"
-	"github.com/sevigo/notify/event"
-)
+// defaultBackend is used by the watches if no backend is selected
+const defaultBackend = "fake"
 
-var ignoreFolders = map[string]bool{}
+var fakeFS *FakeFS
+
+func init() {
+	fakeFS = NewFakeFS("fake", nil)
+}
 
-func (i *DirectoryWatcher) StartWatching(root string, _ *core.WatchingOptions) {
-	time.Sleep(time.Second)
-	fileChangeNotifier(root+"/test.txt", event.FileAdded, nil)
+// DefaultFakeFS returns the file system of the "fake" backend, which is the
+// default backend when the fake build tag is set
+func DefaultFakeFS() *FakeFS {
+	return fakeFS
 }
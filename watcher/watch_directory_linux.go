@@ -1,3 +1,4 @@
+//go:build linux && !integration && !fake
 // +build linux,!integration,!fake
 
 package watcher
@@ -5,18 +6,48 @@ package watcher
 // #include "watch_linux.h"
 import "C"
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
+	"syscall"
+	"time"
 	"unsafe"
 
-	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/clock"
 	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
 )
 
 var ignoreFolders = map[string]bool{}
 
+// defaultBackend is used by the watches if no backend is selected
+const defaultBackend = "inotify"
+
+func init() {
+	registerBuiltinBackend("inotify", (*DirectoryWatcher).startInotify)
+}
+
+// watchMask is the inotify mask used for every watched directory
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_DELETE | syscall.IN_CREATE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB
+
+// readMask is added to the watchMask if the read events are enabled
+const readMask = syscall.IN_OPEN | syscall.IN_ACCESS | syscall.IN_CLOSE_NOWRITE
+
+// rootMask is added to the mask of the root, IN_UNMOUNT and IN_IGNORED are always reported
+const rootMask = syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// rootLostMask are the events which end the watch of the root
+const rootLostMask = syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_UNMOUNT | syscall.IN_IGNORED
+
+// readRootLost is returned by ReadEvents if the root is lost
+const readRootLost = 1
+
+// renameTimeout is how long IN_MOVED_FROM waits for the IN_MOVED_TO with the same cookie,
+// without it the file was moved out of the watched directories
+const renameTimeout = 100 * time.Millisecond
+
 // #define IN_ACCESS		0x00000001	/* File was accessed */
 // #define IN_MODIFY		0x00000002	/* File was modified */
 // #define IN_ATTRIB		0x00000004	/* Metadata changed */
@@ -28,76 +59,526 @@ var ignoreFolders = map[string]bool{}
 // #define IN_CREATE		0x00000100	/* Subfile was created */
 // #define IN_DELETE		0x00000200	/* Subfile was deleted */
 // #define IN_DELETE_SELF	0x00000400	/* Self was deleted */
-func convertMaskToAction(mask int) event.ActionType {
-	switch mask {
-	case 2, 8: // File was modified
-		return event.ActionType(event.FileModified)
-	case 256: // Subfile was created
-		return event.ActionType(event.FileAdded)
-	case 512: // Subfile was deleted
-		return event.ActionType(event.FileRemoved)
-	case 64: // File was moved from X
-		return event.ActionType(event.FileRenamedOldName)
-	case 128: // File was moved to Y
-		return event.ActionType(event.FileRenamedNewName)
+// #define IN_IGNORED		0x00008000	/* Watch was removed */
+// #define IN_ISDIR		0x40000000	/* Event occurred against dir */
+func convertMaskToAction(mask uint32) event.ActionType {
+	isDir := mask&syscall.IN_ISDIR != 0
+	switch {
+	case mask&syscall.IN_CREATE != 0: // Subfile was created
+		if isDir {
+			return event.DirAdded
+		}
+		return event.FileAdded
+	case mask&syscall.IN_DELETE != 0: // Subfile was deleted
+		if isDir {
+			return event.DirRemoved
+		}
+		return event.FileRemoved
+	case mask&(syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE) != 0: // File was modified
+		if isDir {
+			return event.Invalid
+		}
+		return event.FileModified
+	case mask&syscall.IN_ATTRIB != 0: // Metadata changed
+		return event.FileAttributesChanged
+	case mask&syscall.IN_OPEN != 0: // File was opened
+		if isDir {
+			return event.Invalid
+		}
+		return event.FileOpened
+	case mask&syscall.IN_ACCESS != 0: // File was accessed
+		if isDir {
+			return event.Invalid
+		}
+		return event.FileAccessed
+	case mask&syscall.IN_CLOSE_NOWRITE != 0: // Unwrittable file closed
+		if isDir {
+			return event.Invalid
+		}
+		return event.FileClosedNoWrite
+	case mask&syscall.IN_MOVED_FROM != 0: // File was moved from X
+		if isDir {
+			return event.DirRenamed
+		}
+		return event.FileRenamedOldName
+	case mask&syscall.IN_MOVED_TO != 0: // File was moved to Y
+		if isDir {
+			return event.DirRenamed
+		}
+		return event.FileRenamedNewName
 	default:
-		return event.ActionType(event.Invalid)
+		return event.Invalid
 	}
 }
 
-// StartWatching starts a CGO function for getting the notifications
-func (w *DirectoryWatcher) StartWatching(root string, options *core.WatchingOptions) {
-	if _, err := os.Stat(root); os.IsNotExist(err) {
-		fileError("CRITICAL", fmt.Errorf("cannot start watching [%s]: no such directory", root))
-		return
+// pendingMove is an IN_MOVED_FROM waiting for its IN_MOVED_TO
+type pendingMove struct {
+	path   string
+	isDir  bool
+	record InotifyRecord
+	timer  clock.Timer
+}
+
+// inotifyWatch holds one inotify instance for a single watch
+type inotifyWatch struct {
+	*watch
+	stopFd [2]int
+
+	mu sync.Mutex
+	// fd is the inotify instance, it's -1 while the watch is closed.
+	// It is only changed by the goroutine reading the events, the others use it under mu
+	fd int
+	// rootWd is the watch descriptor of the root
+	rootWd int
+	dirs   map[int]string
+	moves  map[uint32]*pendingMove
+	// skipped holds the messages about directories which can't be watched,
+	// they are reported as soon as the watch is running
+	skipped []string
+
+	// poller serves the directories which can't get an inotify watch because of the watch limit
+	poller *poller
+	// activity counts the events of each directory watched by inotify
+	activity map[string]int
+	// degradation is the reason why the directories are polled, warnDegraded is set until it's reported
+	degradation  string
+	warnDegraded bool
+}
+
+var inotifyWatchesMutex sync.Mutex
+var inotifyWatches = make(map[int]*inotifyWatch)
+var inotifyLastID int
+
+func registerInotifyWatch(iw *inotifyWatch) int {
+	inotifyWatchesMutex.Lock()
+	defer inotifyWatchesMutex.Unlock()
+	inotifyLastID++
+	inotifyWatches[inotifyLastID] = iw
+	return inotifyLastID
+}
+
+func unregisterInotifyWatch(id int) {
+	inotifyWatchesMutex.Lock()
+	defer inotifyWatchesMutex.Unlock()
+	delete(inotifyWatches, id)
+}
+
+func lookupInotifyWatch(id int) (*inotifyWatch, bool) {
+	inotifyWatchesMutex.Lock()
+	defer inotifyWatchesMutex.Unlock()
+	iw, ok := inotifyWatches[id]
+	return iw, ok
+}
+
+// startInotify creates an inotify instance for the watch and starts reading the events
+func (w *DirectoryWatcher) startInotify(wt *watch) error {
+	if err := checkWatchable(wt.path); err != nil {
+		return err
 	}
-	err := filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
-		if f.IsDir() {
-			_, found := LookupForCallback(path)
-			if found {
-				fileDebug("INFO", fmt.Sprintf("directory [%s] is already watched", path))
-				return nil
+
+	iw := &inotifyWatch{watch: wt}
+	if err := iw.open(); err != nil {
+		return err
+	}
+	if err := syscall.Pipe2(iw.stopFd[:], syscall.O_CLOEXEC); err != nil {
+		iw.close()
+		return fmt.Errorf("cannot start watching [%s]: %v", wt.path, err)
+	}
+
+	go iw.run(registerInotifyWatch(iw))
+	return nil
+}
+
+// open creates the inotify instance and adds the watched directories
+func (iw *inotifyWatch) open() error {
+	fd := int(C.InitWatcher())
+	if fd < 0 {
+		return fmt.Errorf("cannot start watching [%s]: inotify_init: %v", iw.path, syscall.Errno(-fd))
+	}
+	iw.mu.Lock()
+	iw.fd = fd
+	iw.rootWd = 0
+	iw.dirs = make(map[int]string)
+	iw.moves = make(map[uint32]*pendingMove)
+	iw.activity = make(map[string]int)
+	if iw.poller != nil {
+		iw.poller.clear()
+	}
+	iw.mu.Unlock()
+	if err := iw.addDirectories(iw.path); err != nil {
+		iw.close()
+		return err
+	}
+	return nil
+}
+
+// close releases the inotify instance, the pending moves are dropped
+func (iw *inotifyWatch) close() {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	for _, move := range iw.moves {
+		move.timer.Stop()
+	}
+	iw.moves = make(map[uint32]*pendingMove)
+	if iw.fd >= 0 {
+		syscall.Close(iw.fd)
+		iw.fd = -1
+	}
+}
+
+// addDirectories adds the root and, for recursive watches, all sub-directories.
+// A watched file is tracked with the watch of its directory
+func (iw *inotifyWatch) addDirectories(root string) error {
+	if iw.file {
+		return iw.addDirectory(iw.watchedDir())
+	}
+	if !iw.options.Recursive {
+		return iw.addDirectory(root)
+	}
+	return iw.walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			iw.skipped = append(iw.skipped, fmt.Sprintf("dir [%s] is excluded from watching because of an error: %v", path, err))
+			return nil
+		}
+		if !f.IsDir() {
+			return nil
+		}
+		if ignoreFolders[f.Name()] {
+			return filepath.SkipDir
+		}
+		if err := iw.addDirectory(path); err != nil {
+			if err == errWatchedTwice {
+				return filepath.SkipDir
 			}
-			ch := RegisterCallback(path)
-			fileDebug("INFO", fmt.Sprintf("start watching [%s]", path))
-			go watchDir(root, path, ch)
+			return err
 		}
 		return nil
 	})
+}
+
+// errWatchedTwice is returned by addDirectory if the directory is already
+// watched with another path, e.g. through a followed symlink
+var errWatchedTwice = errors.New("the directory is already watched")
+
+func (iw *inotifyWatch) addDirectory(dir string) error {
+	cdir := C.CString(dir)
+	defer C.free(unsafe.Pointer(cdir))
+
+	mask := iw.mask()
+	isRoot := dir == iw.watchedDir()
+	if isRoot {
+		mask |= rootMask
+	}
+	iw.mu.Lock()
+	if limited := iw.options.MaxKernelWatches > 0 && len(iw.dirs) >= iw.options.MaxKernelWatches; limited && !isRoot {
+		iw.mu.Unlock()
+		iw.pollDirectory(dir, fmt.Sprintf("the limit of %d inotify watches is reached", iw.options.MaxKernelWatches))
+		return nil
+	}
+	// a closed watch has fd -1, inotify_add_watch fails with EBADF then
+	wd := int(C.AddWatch(C.int(iw.fd), cdir, C.uint32_t(mask)))
+	if wd == -int(syscall.ENOSPC) && !isRoot {
+		iw.mu.Unlock()
+		iw.pollDirectory(dir, "the inotify watch limit (fs.inotify.max_user_watches) is reached")
+		return nil
+	}
+	if wd < 0 {
+		iw.mu.Unlock()
+		return fmt.Errorf("cannot start watching [%s]: inotify_add_watch: %v", dir, syscall.Errno(-wd))
+	}
+	if known, ok := iw.dirs[wd]; ok && known != dir {
+		// the same inode returns the same watch descriptor
+		iw.mu.Unlock()
+		return errWatchedTwice
+	}
+	iw.dirs[wd] = dir
+	if isRoot {
+		iw.rootWd = wd
+	}
+	iw.mu.Unlock()
+	if iw.file {
+		iw.attributes.snapshotFile(iw.path)
+	} else {
+		iw.attributes.snapshot(dir)
+	}
+	return nil
+}
+
+// mask returns the inotify mask for the options of the watch
+func (iw *inotifyWatch) mask() uint32 {
+	if iw.options.ReadEvents {
+		return watchMask | readMask
+	}
+	return watchMask
+}
 
-	if options.Rescan {
-		err := w.scan(root)
+func (iw *inotifyWatch) directory(wd int) (string, bool) {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	dir, ok := iw.dirs[wd]
+	return dir, ok
+}
+
+// addSubtree watches a new directory and reports everything which
+// was created inside of it before the watch was added
+func (iw *inotifyWatch) addSubtree(root string) {
+	iw.walk(root, func(path string, f os.FileInfo, err error) error {
 		if err != nil {
-			fileError("CRITICAL", err)
+			iw.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is excluded from watching because of an error: %v", path, err))
+			return nil
+		}
+		if f.IsDir() {
+			if ignoreFolders[f.Name()] {
+				return filepath.SkipDir
+			}
+			if err := iw.addDirectory(path); err == errWatchedTwice {
+				iw.fileDebug("DEBUG", fmt.Sprintf("dir [%s] is skipped, it's already watched", path))
+				return filepath.SkipDir
+			} else if err != nil {
+				iw.fileError("ERROR", err)
+			}
+		}
+		if path == root {
+			return nil
+		}
+		info := fileutil.Info(f)
+		if f.IsDir() {
+			iw.fileChangeNotifier(path, event.DirAdded, &info, nil)
+		} else {
+			iw.fileChangeNotifier(path, event.FileAdded, &info, nil)
+		}
+		return nil
+	})
+	iw.reportDegradation()
+}
+
+// removeSubtree removes the watches of a directory which was moved away
+func (iw *inotifyWatch) removeSubtree(root string) {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	if iw.fd < 0 {
+		return
+	}
+	for wd, dir := range iw.dirs {
+		if isSubPath(root, dir) {
+			C.RemoveWatch(C.int(iw.fd), C.int(wd))
+			delete(iw.dirs, wd)
+		}
+	}
+}
+
+// renameSubtree updates the paths of the watched directories after a rename
+func (iw *inotifyWatch) renameSubtree(oldRoot, newRoot string) {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	for wd, dir := range iw.dirs {
+		if isSubPath(oldRoot, dir) {
+			iw.dirs[wd] = newRoot + dir[len(oldRoot):]
+		}
+	}
+	if iw.poller != nil {
+		iw.poller.rename(oldRoot, newRoot)
+	}
+}
+
+// handle processes a single inotify event, it returns false if the root is lost
+func (iw *inotifyWatch) handle(wd int, name string, mask, cookie uint32) bool {
+	record := InotifyRecord{
+		Wd:     wd,
+		Mask:   mask,
+		Cookie: cookie,
+		Name:   name,
+	}
+	iw.mu.Lock()
+	isRoot := wd == iw.rootWd
+	iw.mu.Unlock()
+	if isRoot && mask&rootLostMask != 0 {
+		iw.rootLost(record)
+		return false
+	}
+
+	dir, ok := iw.directory(wd)
+	if mask&syscall.IN_IGNORED != 0 {
+		// the directory was removed, the watch descriptor is gone
+		iw.mu.Lock()
+		delete(iw.dirs, wd)
+		iw.mu.Unlock()
+	}
+	if !ok {
+		// e.g. IN_Q_OVERFLOW has no watch descriptor
+		dir = iw.path
+	} else {
+		iw.mu.Lock()
+		iw.activity[dir]++
+		iw.mu.Unlock()
+	}
+	absoluteFilePath := filepath.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+	if iw.file {
+		// the renames are not paired, the watched file is either replaced or moved away
+		if action, ok := iw.fileAction(absoluteFilePath, convertMaskToAction(mask)); ok {
+			iw.fileChangeNotifier(absoluteFilePath, action, nil, nil, record)
+		} else if iw.options.Raw && absoluteFilePath == iw.path {
+			iw.fileChangeNotifier(absoluteFilePath, event.Invalid, nil, nil, record)
+		}
+		return true
+	}
+
+	switch {
+	case mask&syscall.IN_MOVED_FROM != 0:
+		iw.movedFrom(cookie, absoluteFilePath, isDir, record)
+	case mask&syscall.IN_MOVED_TO != 0:
+		iw.movedTo(cookie, absoluteFilePath, isDir, record)
+	default:
+		action := convertMaskToAction(mask)
+		if action == event.Invalid || !ok {
+			if iw.options.Raw {
+				iw.fileChangeNotifier(absoluteFilePath, event.Invalid, nil, nil, record)
+			}
+			return true
+		}
+		if action == event.FileAdded && iw.isFollowedDir(absoluteFilePath) {
+			action = event.DirAdded
+		}
+		iw.fileChangeNotifier(absoluteFilePath, action, nil, nil, record)
+		if action == event.DirAdded && iw.options.Recursive {
+			iw.addSubtree(absoluteFilePath)
+		}
+	}
+	return true
+}
+
+func (iw *inotifyWatch) movedFrom(cookie uint32, absoluteFilePath string, isDir bool, record InotifyRecord) {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	iw.moves[cookie] = &pendingMove{
+		path:   absoluteFilePath,
+		isDir:  isDir,
+		record: record,
+		timer: iw.clock.AfterFunc(renameTimeout, func() {
+			iw.movedAway(cookie)
+		}),
+	}
+}
+
+// movedAway reports a file or directory which was moved out of the watched directories
+func (iw *inotifyWatch) movedAway(cookie uint32) {
+	iw.mu.Lock()
+	move, ok := iw.moves[cookie]
+	delete(iw.moves, cookie)
+	iw.mu.Unlock()
+	if !ok {
+		return
+	}
+	if move.isDir {
+		iw.removeSubtree(move.path)
+		iw.fileChangeNotifier(move.path, event.DirRemoved, nil, nil, move.record)
+		return
+	}
+	iw.fileChangeNotifier(move.path, event.FileRemoved, nil, nil, move.record)
+}
+
+func (iw *inotifyWatch) movedTo(cookie uint32, absoluteFilePath string, isDir bool, record InotifyRecord) {
+	iw.mu.Lock()
+	move, ok := iw.moves[cookie]
+	if ok {
+		move.timer.Stop()
+		delete(iw.moves, cookie)
+	}
+	iw.mu.Unlock()
+
+	if !ok {
+		// moved in from outside of the watched directories
+		if isDir {
+			iw.fileChangeNotifier(absoluteFilePath, event.DirAdded, nil, nil, record)
+			if iw.options.Recursive {
+				iw.addSubtree(absoluteFilePath)
+			}
 			return
 		}
+		iw.fileChangeNotifier(absoluteFilePath, event.FileAdded, nil, nil, record)
+		return
 	}
-	if err != nil {
-		fileError("ERROR", err)
+
+	info := &event.AdditionalInfo{OldName: move.path}
+	if isDir {
+		iw.renameSubtree(move.path, absoluteFilePath)
+		iw.fileChangeNotifier(absoluteFilePath, event.DirRenamed, info, nil, move.record, record)
+		return
 	}
+	iw.fileChangeNotifier(absoluteFilePath, event.FileRenamedNewName, info, nil, move.record, record)
 }
 
-func watchDir(rootDirToWatch string, subDir string, ch chan Callback) {
-	croot := C.CString(rootDirToWatch)
-	cdir := C.CString(subDir)
-	defer func() {
-		C.free(unsafe.Pointer(croot))
-		C.free(unsafe.Pointer(cdir))
+// run blocks until the watch is stopped, reading the events has failed
+// or the root is lost. With WaitForRoot a lost root is watched again when it reappears
+func (iw *inotifyWatch) run(id int) {
+	readDone := make(chan struct{})
+	stopDone := make(chan struct{})
+	go func() {
+		defer close(stopDone)
+		select {
+		case <-iw.stopped():
+			syscall.Write(iw.stopFd[1], []byte{0})
+		case <-readDone:
+		}
 	}()
-	go C.WatchDirectory(croot, cdir)
-	for p := range ch {
-		if p.Stop {
-			fileError("INFO", fmt.Errorf("linux.watchDir() stop for %s", subDir))
-			return
+
+	var err error
+	for {
+		for _, msg := range iw.skipped {
+			iw.fileDebug("DEBUG", msg)
+		}
+		iw.skipped = nil
+		iw.reportDegradation()
+
+		res := int(C.ReadEvents(C.int(id), C.int(iw.fd), C.int(iw.stopFd[0])))
+		if res < 0 {
+			err = fmt.Errorf("reading events for [%s] has failed: %v", iw.path, syscall.Errno(-res))
+			iw.fileError("ERROR", err)
+			break
+		}
+		if res != readRootLost {
+			break
 		}
+		if !iw.options.WaitForRoot {
+			err = ErrRootLost
+			break
+		}
+
+		known := iw.attributes.known()
+		iw.close()
+		if !iw.waitForRoot() {
+			break
+		}
+		if err = iw.open(); err != nil {
+			iw.fileError("ERROR", err)
+			break
+		}
+		iw.fileDebug("INFO", fmt.Sprintf("the watched root [%s] is back", iw.path))
+		iw.reconcile(known)
 	}
+
+	close(readDone)
+	<-stopDone
+	unregisterInotifyWatch(id)
+	iw.close()
+	syscall.Close(iw.stopFd[0])
+	syscall.Close(iw.stopFd[1])
+
+	iw.finish(err)
 }
 
 //export goCallbackFileChange
-func goCallbackFileChange(croot, cpath, cfile *C.char, caction C.int) {
-	path := strings.TrimSpace(C.GoString(cpath))
-	file := strings.TrimSpace(C.GoString(cfile))
-	action := convertMaskToAction(int(caction))
-	absoluteFilePath := filepath.Join(path, file)
-	fileChangeNotifier(absoluteFilePath, action, nil)
+func goCallbackFileChange(cid, cwd C.int, cfile *C.char, cmask, ccookie C.uint32_t) C.int {
+	iw, ok := lookupInotifyWatch(int(cid))
+	if !ok {
+		return 0
+	}
+	if !iw.handle(int(cwd), C.GoString(cfile), uint32(cmask), uint32(ccookie)) {
+		return readRootLost
+	}
+	return 0
 }
@@ -0,0 +1,739 @@
+//go:build linux && !integration && !fake
+
+package watcher_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sevigo/notify/clock"
+	"github.com/sevigo/notify/core"
+	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
+	"github.com/sevigo/notify/watcher"
+)
+
+// markers numbers the directories created by settle
+var markers int32
+
+// settle advances the clock when the changes made so far are read and returns their events.
+// The marker directory created in dir is read after the changes, they are all read when the
+// debouncing of the marker and of the count changed paths is pending. It's needed if a change
+// is read as several events, otherwise advance waits for the timers of the changes
+func settle(t *testing.T, c *clock.Fake, ch chan event.Event, dir string, count int) map[string]event.Event {
+	t.Helper()
+	marker := filepath.Join(dir, fmt.Sprintf("marker-%d", atomic.AddInt32(&markers, 1)))
+	require.NoError(t, os.Mkdir(marker, 0o755))
+	c.BlockUntil(count + 1)
+	c.Advance(time.Second)
+	events := collectEvents(t, ch, count+1)
+	for path, e := range events {
+		if e.Path == marker {
+			delete(events, path)
+		}
+	}
+	return events
+}
+
+func TestDirectoryEvents(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	root := t.TempDir()
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Recursive:    true,
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	require.NoError(t, os.Mkdir(filepath.Join(root, "a"), 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "b"), 0o755))
+	events := settle(t, c, eventCh, root, 2)
+	assert.Equal(t, event.DirAdded, events["a"].Action)
+	assert.Equal(t, event.DirAdded, events["b"].Action)
+
+	require.NoError(t, os.Rename(filepath.Join(root, "a"), filepath.Join(root, "c")))
+	require.NoError(t, os.Remove(filepath.Join(root, "b")))
+	events = settle(t, c, eventCh, root, 2)
+	assert.Equal(t, event.DirRenamed, events["c"].Action)
+	assert.Equal(t, filepath.Join(root, "a"), events["c"].OldName)
+	assert.Equal(t, event.DirRemoved, events["b"].Action)
+
+	// the renamed directory is still watched with its new name
+	require.NoError(t, os.WriteFile(filepath.Join(root, "c", "test.txt"), []byte("c"), 0o600))
+	events = settle(t, c, eventCh, root, 1)
+	assert.Equal(t, event.FileAdded, events[filepath.Join("c", "test.txt")].Action)
+}
+
+func TestAttributeEvents(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	file := filepath.Join(root, "test.txt")
+	require.NoError(t, os.WriteFile(file, []byte("test"), 0o600))
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	require.NoError(t, os.Chmod(file, 0o644))
+	e := advance(t, c, eventCh, 1)[0]
+	assert.Equal(t, "test.txt", e.RelativePath)
+	assert.Equal(t, event.FileAttributesChanged, e.Action)
+	assert.Equal(t, event.AttributeMode, e.ChangedAttributes)
+	assert.Equal(t, os.FileMode(0o644), e.Mode)
+}
+
+func TestReadEvents(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	file := filepath.Join(root, "test.txt")
+	require.NoError(t, os.WriteFile(file, []byte("test"), 0o600))
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		ReadEvents:   true,
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	_, err = os.ReadFile(file)
+	require.NoError(t, err)
+
+	// the read events are not merged with each other
+	actions := make(map[event.ActionType]bool)
+	for _, e := range advance(t, c, eventCh, 3) {
+		assert.Equal(t, file, e.Path)
+		actions[e.Action] = true
+	}
+	assert.True(t, actions[event.FileOpened])
+	assert.True(t, actions[event.FileAccessed])
+	assert.True(t, actions[event.FileClosedNoWrite])
+}
+
+func TestRawEvents(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Raw:          true,
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	require.NoError(t, os.Mkdir(filepath.Join(root, "a"), 0o755))
+	e := advance(t, c, eventCh, 1)[0]
+	assert.Equal(t, "a", e.RelativePath)
+	assert.Equal(t, event.DirAdded, e.Action)
+	require.Len(t, e.Raw, 1)
+	record, ok := e.Raw[0].(watcher.InotifyRecord)
+	require.True(t, ok)
+	assert.Equal(t, "a", record.Name)
+	assert.Equal(t, "IN_CREATE|IN_ISDIR", record.MaskString())
+}
+
+func TestRootLost(t *testing.T) {
+	t.Parallel()
+	root := filepath.Join(t.TempDir(), "root")
+	require.NoError(t, os.Mkdir(root, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "test.txt"), []byte("test"), 0o600))
+
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	require.NoError(t, os.RemoveAll(root))
+	events := collectEvents(t, eventCh, 2)
+	assert.Equal(t, event.FileRemoved, events["test.txt"].Action)
+	assert.Equal(t, event.WatchRootLost, events["."].Action)
+	// the pending events are sent before the root is reported as lost
+	assert.Less(t, events["test.txt"].Seq, events["."].Seq)
+
+	<-w.Done()
+	assert.Equal(t, watcher.ErrRootLost, w.Err())
+}
+
+func TestRenameTimeout(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.Mkdir(root, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "test.txt"), []byte("test"), 0o600))
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewFake(start)
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// a file moved out of the watched directory is removed when its new name is not reported within 100ms
+	require.NoError(t, os.Rename(filepath.Join(root, "test.txt"), filepath.Join(dir, "test.txt")))
+	c.BlockUntil(1)
+	c.Advance(100 * time.Millisecond)
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	e := <-eventCh
+	assert.Equal(t, event.FileRemoved, e.Action)
+	assert.Equal(t, "test.txt", e.RelativePath)
+	assert.Equal(t, start.Add(100*time.Millisecond), e.DetectedAt)
+}
+
+func TestWaitForRoot(t *testing.T) {
+	t.Parallel()
+	root := filepath.Join(t.TempDir(), "root")
+	require.NoError(t, os.Mkdir(root, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "old.txt"), []byte("old"), 0o600))
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		WaitForRoot:  true,
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	moved := root + ".moved"
+	require.NoError(t, os.Rename(root, moved))
+	events := collectEvents(t, eventCh, 1)
+	assert.Equal(t, event.WatchRootLost, events["."].Action)
+
+	// the reconciliation scan reports the differences to the lost root,
+	// the root is created with its contents at once
+	next := filepath.Join(filepath.Dir(root), "next")
+	require.NoError(t, os.Mkdir(next, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(next, "new.txt"), []byte("new"), 0o600))
+	require.NoError(t, os.Rename(next, root))
+	events = make(map[string]event.Event)
+	for _, e := range advance(t, c, eventCh, 2) {
+		events[e.RelativePath] = e
+	}
+	assert.Equal(t, event.FileRemoved, events["old.txt"].Action)
+	assert.Equal(t, event.FileAdded, events["new.txt"].Action)
+
+	// the watch is running again
+	require.NoError(t, os.Remove(filepath.Join(root, "new.txt")))
+	e := advance(t, c, eventCh, 1)[0]
+	assert.Equal(t, event.FileRemoved, e.Action)
+	assert.Equal(t, "new.txt", e.RelativePath)
+	assert.Nil(t, w.Err())
+}
+
+func TestWaitForCreation(t *testing.T) {
+	t.Parallel()
+	base := t.TempDir()
+	root := filepath.Join(base, "a", "b", "root")
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		WaitForCreation: true,
+		EventCh:         eventCh,
+		ErrorHandler:    func(event.Error) {},
+		Clock:           c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// the initial contents are reported when the path is created,
+	// the root is created with its contents at once
+	next := filepath.Join(base, "next")
+	require.NoError(t, os.MkdirAll(filepath.Join(next, "dir"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(next, "test.txt"), []byte("test"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Dir(root), 0o755))
+	require.NoError(t, os.Rename(next, root))
+	events := make(map[string]event.Event)
+	for _, e := range advance(t, c, eventCh, 2) {
+		events[e.RelativePath] = e
+	}
+	assert.Equal(t, event.DirAdded, events["dir"].Action)
+	assert.Equal(t, event.FileAdded, events["test.txt"].Action)
+
+	require.NoError(t, os.Remove(filepath.Join(root, "test.txt")))
+	e := advance(t, c, eventCh, 1)[0]
+	assert.Equal(t, event.FileRemoved, e.Action)
+	assert.Equal(t, "test.txt", e.RelativePath)
+}
+
+func TestWatchFile(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	file := filepath.Join(root, "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("a: 1"), 0o600))
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), file, &core.WatchingOptions{
+		ReadEvents:   true,
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// the file is opened after the changes as a marker, they are all read when the debouncing
+	// of the changes and of the two read events of the marker is pending
+	changed := func() event.Event {
+		t.Helper()
+		f, err := os.Open(file)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		var changes []event.Event
+		for _, e := range advance(t, c, eventCh, 3) {
+			if e.Action != event.FileOpened && e.Action != event.FileClosedNoWrite {
+				changes = append(changes, e)
+			}
+		}
+		require.Len(t, changes, 1)
+		return changes[0]
+	}
+
+	// the other files of the directory are not reported
+	require.NoError(t, os.WriteFile(filepath.Join(root, "other.txt"), []byte("other"), 0o600))
+	require.NoError(t, os.WriteFile(file, []byte("a: 2"), 0o600))
+	e := changed()
+	assert.Equal(t, event.FileModified, e.Action)
+	assert.Equal(t, file, e.Path)
+
+	// the file is still tracked after it was atomically replaced
+	tmp := filepath.Join(root, ".config.yaml.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("a: 3"), 0o600))
+	require.NoError(t, os.Rename(tmp, file))
+	e = changed()
+	assert.Equal(t, event.FileReplaced, e.Action)
+	assert.Equal(t, int64(4), e.Size)
+
+	// the removal is not reported if the file is created again before the event is sent
+	require.NoError(t, os.Remove(file))
+	require.NoError(t, os.WriteFile(file, []byte("a: 10"), 0o600))
+	e = changed()
+	assert.Equal(t, event.FileReplaced, e.Action)
+	assert.Equal(t, int64(5), e.Size)
+
+	require.NoError(t, os.Remove(file))
+	e = advance(t, c, eventCh, 1)[0]
+	assert.Equal(t, event.FileRemoved, e.Action)
+	assert.Equal(t, file, e.Path)
+}
+
+func TestResolveSymlinks(t *testing.T) {
+	t.Parallel()
+	// the layout of a mounted ConfigMap, key -> ..data/key -> ..v1/key
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "..v1"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "..v1", "key"), []byte("v1"), 0o600))
+	require.NoError(t, os.Symlink("..v1", filepath.Join(root, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "key"), filepath.Join(root, "key")))
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		ResolveSymlinks: true,
+		EventCh:         eventCh,
+		ErrorHandler:    func(event.Error) {},
+		Clock:           c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// the ..data link is swapped atomically to the new version, the new
+	// version, the temporary link and the swapped link are reported as well
+	require.NoError(t, os.Mkdir(filepath.Join(root, "..v2"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "..v2", "key"), []byte("v2"), 0o600))
+	require.NoError(t, os.Symlink("..v2", filepath.Join(root, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(root, "..data_tmp"), filepath.Join(root, "..data")))
+	events := settle(t, c, eventCh, root, 4)
+	assert.Equal(t, event.FileModified, events["key"].Action)
+	assert.Equal(t, event.FileRenamedNewName, events["..data"].Action)
+
+	// a link added later is resolved with the changed path, the other links are not walked again
+	require.NoError(t, os.WriteFile(filepath.Join(root, "..v2", "key2"), []byte("v2"), 0o600))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "key2"), filepath.Join(root, "key2")))
+	events = settle(t, c, eventCh, root, 1)
+	assert.Equal(t, event.FileAdded, events["key2"].Action)
+	require.NoError(t, os.Mkdir(filepath.Join(root, "..v3"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "..v3", "key"), []byte("v3"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "..v3", "key2"), []byte("v3"), 0o600))
+	require.NoError(t, os.Symlink("..v3", filepath.Join(root, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(root, "..data_tmp"), filepath.Join(root, "..data")))
+	events = settle(t, c, eventCh, root, 5)
+	assert.Equal(t, event.FileModified, events["key"].Action)
+	assert.Equal(t, event.FileModified, events["key2"].Action)
+}
+
+func TestSymlinkPolicy(t *testing.T) {
+	t.Parallel()
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sub"), 0o755))
+	require.NoError(t, os.Mkdir(outside, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "test.txt"), []byte("test"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "linked.txt"), []byte("linked"), 0o600))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link")))
+	// the loops neither hang the scan nor add watches twice
+	require.NoError(t, os.Symlink(root, filepath.Join(root, "sub", "loop")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "alias")))
+
+	tests := []struct {
+		policy core.SymlinkPolicy
+		want   map[string]event.ActionType
+	}{
+		{
+			policy: core.SymlinkIgnore,
+			want: map[string]event.ActionType{
+				"sub":                            event.DirAdded,
+				filepath.Join("sub", "test.txt"): event.FileAdded,
+			},
+		},
+		{
+			policy: core.SymlinkReport,
+			want: map[string]event.ActionType{
+				"sub":                            event.DirAdded,
+				filepath.Join("sub", "test.txt"): event.FileAdded,
+				filepath.Join("sub", "loop"):     event.FileAdded,
+				"link":                           event.FileAdded,
+				"alias":                          event.FileAdded,
+			},
+		},
+		{
+			policy: core.SymlinkFollow,
+			want: map[string]event.ActionType{
+				"sub":                               event.DirAdded,
+				filepath.Join("sub", "test.txt"):    event.FileAdded,
+				"link":                              event.DirAdded,
+				filepath.Join("link", "linked.txt"): event.FileAdded,
+			},
+		},
+	}
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	for _, tt := range tests {
+		eventCh := make(chan event.Event)
+		w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+			Rescan:        true,
+			Recursive:     true,
+			SymlinkPolicy: tt.policy,
+			EventCh:       eventCh,
+			ErrorHandler:  func(event.Error) {},
+			Clock:         c,
+		})
+		require.NoError(t, err)
+
+		events := make(map[string]event.Event)
+		for _, e := range advance(t, c, eventCh, len(tt.want)) {
+			events[e.RelativePath] = e
+		}
+		for path, action := range tt.want {
+			assert.Equal(t, action, events[path].Action, "policy %d, path %s", tt.policy, path)
+		}
+		if tt.policy == core.SymlinkFollow {
+			// the target of the link is watched with the path of the link
+			require.NoError(t, os.WriteFile(filepath.Join(outside, "new.txt"), []byte("new"), 0o600))
+			events = settle(t, c, eventCh, root, 1)
+			assert.Equal(t, event.FileAdded, events[filepath.Join("link", "new.txt")].Action)
+		}
+		w.Stop()
+	}
+}
+
+func TestFileSystemBoundaries(t *testing.T) {
+	t.Parallel()
+	other, err := os.MkdirTemp("/dev/shm", "notify")
+	if err != nil {
+		t.Skip("no other file system is available:", err)
+	}
+	defer os.RemoveAll(other)
+	root := t.TempDir()
+	if fsType, _ := fileutil.FSType(root); fsType == "tmpfs" {
+		t.Skip("the temporary directory is on tmpfs")
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(other, "other.txt"), []byte("other"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0o755))
+	// the followed link leads to another file system
+	require.NoError(t, os.Symlink(other, filepath.Join(root, "shm")))
+
+	tests := []struct {
+		name    string
+		options core.WatchingOptions
+		want    []string
+	}{
+		{
+			name: "all file systems",
+			want: []string{"sub", "shm", filepath.Join("shm", "other.txt")},
+		},
+		{
+			name:    "one file system",
+			options: core.WatchingOptions{OneFileSystem: true},
+			want:    []string{"sub"},
+		},
+		{
+			name:    "excluded file system type",
+			options: core.WatchingOptions{ExcludeFSTypes: []string{"proc", "tmpfs"}},
+			want:    []string{"sub"},
+		},
+	}
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	for _, tt := range tests {
+		eventCh := make(chan event.Event)
+		options := tt.options
+		options.Rescan = true
+		options.Recursive = true
+		options.SymlinkPolicy = core.SymlinkFollow
+		options.EventCh = eventCh
+		options.ErrorHandler = func(event.Error) {}
+		options.Clock = c
+		w, err := directoryWatcher.StartWatching(context.TODO(), root, &options)
+		require.NoError(t, err)
+
+		var paths []string
+		for _, e := range advance(t, c, eventCh, len(tt.want)) {
+			paths = append(paths, e.RelativePath)
+		}
+		assert.ElementsMatch(t, tt.want, paths, tt.name)
+		w.Stop()
+	}
+}
+
+func TestHybridPolling(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "a"), 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "b"), 0o755))
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	errorCh := make(chan event.Error, 100)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Recursive:        true,
+		MaxKernelWatches: 2,
+		PollInterval:     time.Second,
+		PollMaxInterval:  time.Second,
+		EventCh:          eventCh,
+		ErrorHandler: func(e event.Error) {
+			select {
+			case errorCh <- e:
+			default:
+			}
+		},
+		Clock: c,
+	})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// waitForError returns the first error which contains the message
+	waitForError := func(msg string) event.Error {
+		for {
+			if e := <-errorCh; strings.Contains(e.Message, msg) {
+				return e
+			}
+		}
+	}
+	warning := waitForError("is partly polled")
+	assert.Equal(t, "WARNING", warning.Level)
+	assert.Equal(t, root, warning.Path)
+	require.NotNil(t, warning.Degradation)
+	assert.Equal(t, 2, warning.Degradation.KernelDirs)
+	assert.Equal(t, 1, warning.Degradation.PolledDirs)
+
+	// b is polled, its changes are reported by the poller
+	c.BlockUntil(1)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "b", "1.txt"), []byte("1"), 0o600))
+	c.Advance(time.Second)
+	// the active polled directory gets the inotify watch of the inactive one
+	waitForError(fmt.Sprintf("dir [%s] is watched by inotify instead of [%s]", filepath.Join(root, "b"), filepath.Join(root, "a")))
+	// the next poll and the debouncing of the change
+	c.BlockUntil(2)
+	c.Advance(time.Second)
+	events := collectEvents(t, eventCh, 1)
+	assert.Equal(t, event.FileAdded, events[filepath.Join("b", "1.txt")].Action)
+
+	// the change of b keeps its inotify watch, the symlink is reported by a single
+	// inotify event which is debounced by the next poll
+	c.BlockUntil(1)
+	require.NoError(t, os.Symlink("1.txt", filepath.Join(root, "b", "3.txt")))
+	c.BlockUntil(2)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a", "2.txt"), []byte("2"), 0o600))
+	c.Advance(time.Second)
+	c.BlockUntil(2)
+	c.Advance(time.Second)
+	events = collectEvents(t, eventCh, 2)
+	assert.Equal(t, event.FileAdded, events[filepath.Join("a", "2.txt")].Action)
+	assert.Equal(t, event.FileAdded, events[filepath.Join("b", "3.txt")].Action)
+}
+
+func TestFanotify(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "old.txt"), []byte("old"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(outside, "moved"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "moved", "test.txt"), []byte("test"), 0o600))
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:      "fanotify",
+		Recursive:    true,
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	if errors.Is(err, watcher.ErrFanotifyPermission) || errors.Is(err, watcher.ErrFanotifyUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	defer w.Stop()
+
+	// the changes of the other paths on the same file system are dropped
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "ignored.txt"), []byte("ignored"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "moved", "before.txt"), []byte("before"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "first.txt"), []byte("first"), 0o600))
+	events := settle(t, c, eventCh, root, 1)
+	assert.Equal(t, event.FileAdded, events["first.txt"].Action)
+	assert.Len(t, events, 1)
+
+	// a directory is watched as soon as it's created
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "dir", "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "dir", "sub", "new.txt"), []byte("new"), 0o600))
+	require.NoError(t, os.Rename(filepath.Join(root, "old.txt"), filepath.Join(root, "dir", "renamed.txt")))
+	require.NoError(t, os.Rename(filepath.Join(outside, "moved"), filepath.Join(root, "moved")))
+	events = settle(t, c, eventCh, root, 7)
+	assert.Equal(t, event.DirAdded, events["dir"].Action)
+	assert.Equal(t, event.DirAdded, events[filepath.Join("dir", "sub")].Action)
+	assert.Equal(t, event.FileAdded, events[filepath.Join("dir", "sub", "new.txt")].Action)
+	assert.Equal(t, event.FileRenamedNewName, events[filepath.Join("dir", "renamed.txt")].Action)
+	assert.Equal(t, filepath.Join(root, "old.txt"), events[filepath.Join("dir", "renamed.txt")].OldName)
+	assert.Equal(t, event.DirAdded, events["moved"].Action)
+	assert.Equal(t, event.FileAdded, events[filepath.Join("moved", "test.txt")].Action)
+	assert.Equal(t, event.FileAdded, events[filepath.Join("moved", "before.txt")].Action)
+	assert.Len(t, events, 7)
+
+	// the directory moved in isn't dropped as outside of the watch anymore
+	require.NoError(t, os.Remove(filepath.Join(root, "moved", "test.txt")))
+	events = settle(t, c, eventCh, root, 1)
+	assert.Equal(t, event.FileRemoved, events[filepath.Join("moved", "test.txt")].Action)
+
+	// the watch ends with its root, the pending events are sent without waiting.
+	// The three markers of settle are removed as well
+	require.NoError(t, os.RemoveAll(root))
+	events = collectEvents(t, eventCh, 8+3)
+	assert.Equal(t, event.DirRemoved, events["moved"].Action)
+	assert.Equal(t, event.WatchRootLost, events["."].Action)
+	<-w.Done()
+	assert.Equal(t, watcher.ErrRootLost, w.Err())
+}
+
+func TestFanotifyProcessInfo(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:      "fanotify",
+		ProcessInfo:  true,
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	if errors.Is(err, watcher.ErrFanotifyPermission) || errors.Is(err, watcher.ErrFanotifyUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	defer w.Stop()
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "test.txt"), []byte("test"), 0o600))
+	events := settle(t, c, eventCh, root, 1)
+	process := events["test.txt"].Process
+	require.NotNil(t, process)
+	assert.Equal(t, os.Getpid(), process.PID)
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	assert.Equal(t, exe, process.Exe)
+	assert.Equal(t, os.Args, process.Cmdline)
+	require.NotNil(t, process.UID)
+	assert.Equal(t, uint32(os.Getuid()), *process.UID)
+}
+
+func TestFsnotifyBackend(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0o755))
+
+	c := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	eventCh := make(chan event.Event)
+	w, err := directoryWatcher.StartWatching(context.TODO(), root, &core.WatchingOptions{
+		Backend:      "fsnotify",
+		Recursive:    true,
+		EventCh:      eventCh,
+		ErrorHandler: func(event.Error) {},
+		Clock:        c,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "dir", "test.txt"), []byte("test"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "new", "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "new", "sub", "new.txt"), []byte("new"), 0o600))
+	events := settle(t, c, eventCh, root, 4)
+	assert.Equal(t, event.FileAdded, events[filepath.Join("dir", "test.txt")].Action)
+	assert.Equal(t, event.DirAdded, events["new"].Action)
+	assert.Equal(t, event.DirAdded, events[filepath.Join("new", "sub")].Action)
+	assert.Equal(t, event.FileAdded, events[filepath.Join("new", "sub", "new.txt")].Action)
+
+	// fsnotify doesn't pair the renames, the contents of the new name are reported and watched
+	require.NoError(t, os.Rename(filepath.Join(root, "new"), filepath.Join(root, "renamed")))
+	events = settle(t, c, eventCh, root, 4)
+	assert.Equal(t, event.DirRemoved, events["new"].Action)
+	assert.Equal(t, event.DirAdded, events["renamed"].Action)
+	assert.Equal(t, event.DirAdded, events[filepath.Join("renamed", "sub")].Action)
+	assert.Equal(t, event.FileAdded, events[filepath.Join("renamed", "sub", "new.txt")].Action)
+	require.NoError(t, os.Remove(filepath.Join(root, "renamed", "sub", "new.txt")))
+	events = settle(t, c, eventCh, root, 1)
+	assert.Equal(t, event.FileRemoved, events[filepath.Join("renamed", "sub", "new.txt")].Action)
+
+	w.Stop()
+	select {
+	case <-w.Done():
+	default:
+		t.Fatal("the watch is not ended")
+	}
+	assert.NoError(t, w.Err())
+}
@@ -1,38 +1,30 @@
+//go:build !fake
+// +build !fake
+
 package watcher_test
 
 import (
 	"context"
-	"fmt"
+	"os"
 	"path/filepath"
 	"sync"
 	"testing"
-	"time"
 
-	"github.com/sevigo/notify"
 	"github.com/sevigo/notify/core"
 	"github.com/sevigo/notify/event"
 	"github.com/sevigo/notify/watcher"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-var directoryWatcher core.DirectoryWatcher
-
-func init() {
-	directoryWatcher = notify.Setup(context.TODO(), nil)
-	go func() {
-		for err := range directoryWatcher.Error() {
-			fmt.Printf("[%s] %q\n", err.Level, err.Message)
-
-		}
-	}()
-}
-
 func TestStartWatching(t *testing.T) {
 	watchPath := "testdata"
 	options := &core.WatchingOptions{
 		Rescan: true,
 	}
-	go directoryWatcher.StartWatching(watchPath, options)
+	w, err := directoryWatcher.StartWatching(context.TODO(), watchPath, options)
+	require.NoError(t, err)
+	defer w.Stop()
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -46,7 +38,13 @@ func TestStartWatching(t *testing.T) {
 	expectedDir := filepath.Join("testdata", "test.txt")
 	assert.Equal(t, "added", watcher.ActionToString(event.Action))
 	assert.Equal(t, expectedDir, event.Path)
-	directoryWatcher.StopWatching(watchPath)
+	assert.Equal(t, "testdata", event.Root)
+	assert.Equal(t, "test.txt", event.RelativePath)
+
+	fileInfo, err := os.Stat(expectedDir)
+	require.NoError(t, err)
+	assert.Equal(t, fileInfo.Size(), event.Size)
+	assert.Equal(t, fileInfo.Mode(), event.Mode)
 }
 
 func TestRescan(t *testing.T) {
@@ -62,9 +60,8 @@ func TestRescan(t *testing.T) {
 	options := &core.WatchingOptions{
 		Rescan: false,
 	}
-	go directoryWatcher.StartWatching(watchPath, options)
-	// give StartWatching some time to do the initial work
-	time.Sleep(time.Second)
+	_, err := directoryWatcher.StartWatching(context.TODO(), watchPath, options)
+	require.NoError(t, err)
 	directoryWatcher.RescanAll()
 
 	wg.Wait()
@@ -73,3 +70,97 @@ func TestRescan(t *testing.T) {
 	assert.Equal(t, expectedDir, event.Path)
 	directoryWatcher.StopWatching(watchPath)
 }
+
+func TestStartWatchingErrors(t *testing.T) {
+	w, err := directoryWatcher.StartWatching(context.TODO(), "testdata", &core.WatchingOptions{})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	_, err = directoryWatcher.StartWatching(context.TODO(), "testdata", &core.WatchingOptions{})
+	assert.Error(t, err)
+}
+
+func TestStop(t *testing.T) {
+	options := &core.WatchingOptions{
+		Recursive: true,
+	}
+	w, err := directoryWatcher.StartWatching(context.TODO(), "testdata", options)
+	require.NoError(t, err)
+	assert.Equal(t, "testdata", w.Path())
+	assert.Equal(t, *options, w.Options())
+
+	select {
+	case <-w.Done():
+		t.Fatal("watch is done before Stop()")
+	default:
+	}
+
+	w.Stop()
+	<-w.Done()
+	assert.NoError(t, w.Err())
+
+	// the path can be watched again after the watch was stopped
+	w, err = directoryWatcher.StartWatching(context.TODO(), "testdata", options)
+	require.NoError(t, err)
+	w.Stop()
+}
+
+func TestContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := directoryWatcher.StartWatching(ctx, "testdata", &core.WatchingOptions{})
+	require.NoError(t, err)
+
+	other, err := directoryWatcher.StartWatching(context.TODO(), filepath.Join("testdata", "..", "..", "fileutil", "testdata"), &core.WatchingOptions{})
+	require.NoError(t, err)
+	defer other.Stop()
+
+	cancel()
+	<-w.Done()
+	assert.Equal(t, context.Canceled, w.Err())
+
+	select {
+	case <-other.Done():
+		t.Fatal("cancelling the context has stopped another watch")
+	default:
+	}
+}
+
+func TestWatchChannels(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dirA, "test.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dirB, "test.txt"), []byte("b"), 0o600))
+
+	eventCh := make(chan event.Event)
+	errorCh := make(chan event.Error)
+	go func() {
+		for range errorCh {
+		}
+	}()
+	a, err := directoryWatcher.StartWatching(context.TODO(), dirA, &core.WatchingOptions{
+		Rescan:  true,
+		EventCh: eventCh,
+		ErrorCh: errorCh,
+	})
+	require.NoError(t, err)
+	defer a.Stop()
+
+	handled := make(chan event.Event, 1)
+	b, err := directoryWatcher.StartWatching(context.TODO(), dirB, &core.WatchingOptions{
+		Rescan: true,
+		EventHandler: func(e event.Event) {
+			select {
+			case handled <- e:
+			default:
+			}
+		},
+		ErrorHandler: func(event.Error) {},
+	})
+	require.NoError(t, err)
+	defer b.Stop()
+
+	e := <-eventCh
+	assert.Equal(t, filepath.Join(dirA, "test.txt"), e.Path)
+	e = <-handled
+	assert.Equal(t, filepath.Join(dirB, "test.txt"), e.Path)
+}
@@ -1,4 +1,5 @@
-// +build windows,!integration,!fake
+//go:build windows && !integration && !fake
+
 package watcher
 
 // #include "watch_windows.h"
@@ -8,18 +9,23 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 	"unsafe"
 
-	"github.com/sevigo/notify/core"
 	"github.com/sevigo/notify/event"
+	"github.com/sevigo/notify/fileutil"
 )
 
 var eventCache chan event.Event
 
+// defaultBackend is used by the watches if no backend is selected
+const defaultBackend = "windows"
+
 func init() {
 	C.Setup()
 	eventCache = make(chan event.Event, 1)
+	registerBuiltinBackend("windows", (*DirectoryWatcher).startWindows)
 }
 
 // exclude these folders from the recursive scan
@@ -30,44 +36,55 @@ var ignoreFolders = map[string]bool{
 	`$SysReset`:    true,
 }
 
-// StartWatching starts a CGO function for getting the notifications
-func (w *DirectoryWatcher) StartWatching(path string, options *core.WatchingOptions) {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		fileError("CRITICAL", fmt.Errorf("can't start watching [%s]: %v", path, err))
-		return
-	}
+// the watches by the directory passed to WatchDirectory, a watched file
+// is tracked with its directory, which can't be watched at the same time
+var dirWatchesMutex sync.Mutex
+var dirWatches = make(map[string]*watch)
 
-	_, found := LookupForCallback(path)
-	if found {
-		fileDebug("INFO", fmt.Sprintf("directory [%s] is already watched", path))
-		return
-	}
+func lookupDirWatch(dir string) (*watch, bool) {
+	dirWatchesMutex.Lock()
+	defer dirWatchesMutex.Unlock()
+	wt, ok := dirWatches[dir]
+	return wt, ok
+}
 
-	ch := RegisterCallback(path)
-	fileDebug("INFO", fmt.Sprintf("start watching [%s]", path))
-	cpath := C.CString(path)
-	defer func() {
-		C.free(unsafe.Pointer(cpath))
-	}()
+// startWindows starts a CGO function for getting the notifications
+func (w *DirectoryWatcher) startWindows(wt *watch) error {
+	if err := checkWatchable(wt.path); err != nil {
+		return err
+	}
+	dir := wt.watchedDir()
+	dirWatchesMutex.Lock()
+	if _, found := dirWatches[dir]; found {
+		dirWatchesMutex.Unlock()
+		return fmt.Errorf("[%s] is already watched", dir)
+	}
+	dirWatches[dir] = wt
+	dirWatchesMutex.Unlock()
+	wt.snapshot()
 
+	cpath := C.CString(dir)
+	watching := make(chan struct{})
 	go func() {
-		for p := range ch {
-			if p.Stop {
-				C.StopWatching(cpath)
-			}
+		select {
+		case <-wt.stopped():
+			cstop := C.CString(dir)
+			C.StopWatching(cstop)
+			C.free(unsafe.Pointer(cstop))
+		case <-watching:
 		}
 	}()
 
-	if options.Rescan {
-		err := w.scan(path)
-		if err != nil {
-			fileError("CRITICAL", fmt.Errorf("can't scan [%s]: %v", path, err))
-			return
-		}
-	}
-
-	C.WatchDirectory(cpath)
-	fileDebug("INFO", fmt.Sprintf("[%s] is not watched anymore", path))
+	go func() {
+		C.WatchDirectory(cpath)
+		close(watching)
+		C.free(unsafe.Pointer(cpath))
+		dirWatchesMutex.Lock()
+		delete(dirWatches, dir)
+		dirWatchesMutex.Unlock()
+		wt.finish(nil)
+	}()
+	return nil
 }
 
 //export goCallbackFileChange
@@ -75,11 +92,25 @@ func goCallbackFileChange(cpath, cfile *C.char, caction C.int) {
 	path := strings.TrimSpace(C.GoString(cpath))
 	file := strings.TrimSpace(C.GoString(cfile))
 	action := event.ActionType(int(caction))
+	wt, ok := lookupDirWatch(path)
+	if !ok {
+		return
+	}
 
 	absoluteFilePath := filepath.Join(path, file)
+	if action == event.FileModified {
+		action = wt.modifiedAction(absoluteFilePath)
+	}
+	if wt.file {
+		// the renames are not paired, the watched file is either replaced or moved away
+		if action, ok := wt.fileAction(absoluteFilePath, action); ok {
+			wt.fileChangeNotifier(absoluteFilePath, action, nil, nil)
+		}
+		return
+	}
 	switch action {
 	case event.FileRenamedOldName:
-		go waitForRenameToEvent(absoluteFilePath)
+		go wt.waitForRenameToEvent(absoluteFilePath)
 		return
 	case event.FileRenamedNewName:
 		eventCache <- event.Event{
@@ -88,43 +119,90 @@ func goCallbackFileChange(cpath, cfile *C.char, caction C.int) {
 		}
 		return
 	default:
-		if ok := checkValidFile(absoluteFilePath, action); ok {
-			fileChangeNotifier(absoluteFilePath, action, nil)
+		if action, ok := checkValidFile(absoluteFilePath, action); ok {
+			wt.fileChangeNotifier(absoluteFilePath, action, nil, nil)
 		}
 	}
 }
 
-func checkValidFile(absoluteFilePath string, action event.ActionType) bool {
+// checkValidFile returns the action for the file or directory and false if the event should be dropped.
+// Removed directories can't be told apart from files and are reported as FileRemoved
+func checkValidFile(absoluteFilePath string, action event.ActionType) (event.ActionType, bool) {
 	// if the file is removed we are good and the event is valid
 	if action == event.FileRemoved {
-		return true
+		return action, true
 	}
 	if action == event.FileRenamedOldName {
-		return true
+		return action, true
 	}
 	// we are checking this because windows tend to create some tmp files if this is a download files
 	starts, err := os.Stat(absoluteFilePath)
+	if err != nil {
+		return action, false
+	}
 	if starts.IsDir() {
-		fmt.Printf("[notify] checkValidFile(): file %q is invalid\n", absoluteFilePath)
-		return false
+		switch action {
+		case event.FileAdded:
+			return event.DirAdded, true
+		case event.FileRenamedNewName:
+			return event.DirRenamed, true
+		case event.FileAttributesChanged:
+			return action, true
+		default:
+			// a modified directory is a change of its content, which is reported on its own
+			return action, false
+		}
+	}
+	return action, true
+}
+
+// snapshot fills the attribute cache with the watched files, the changes of the
+// attributes are told apart from the writes by comparing the metadata
+func (wt *watch) snapshot() {
+	if wt.file {
+		wt.attributes.snapshotFile(wt.path)
+		return
+	}
+	wt.walk(wt.path, func(path string, f os.FileInfo, err error) error {
+		if err == nil && f.IsDir() {
+			wt.attributes.snapshot(path)
+		}
+		return nil
+	})
+}
+
+// modifiedAction returns FileAttributesChanged if the size and the modification time of the
+// file are unchanged, Windows reports the writes and the changes of the attributes or the
+// security descriptor with the same action
+func (wt *watch) modifiedAction(absoluteFilePath string) event.ActionType {
+	previous, ok := wt.attributes.lookup(absoluteFilePath)
+	if !ok {
+		return event.FileModified
+	}
+	info, err := fileutil.Stat(absoluteFilePath)
+	if err != nil {
+		return event.FileModified
+	}
+	if info.Size == previous.Size && info.ModTime.Equal(previous.ModTime) {
+		return event.FileAttributesChanged
 	}
-	return err == nil
+	return event.FileModified
 }
 
 // we assuming that the FileRenamedOldName and FileRenamedNewName are fired together by win api
-func waitForRenameToEvent(oldPath string) {
-	fmt.Printf("[notify] waitForRenameToEvent(): old name is %q\n", oldPath)
+func (wt *watch) waitForRenameToEvent(oldPath string) {
+	wt.fileDebug("DEBUG", fmt.Sprintf("file [%s] is renamed, waiting for its new name", oldPath))
 	for {
 		select {
 		case e := <-eventCache:
 			if e.Action == event.FileRenamedNewName {
 				newPath := e.Path
-				if ok := checkValidFile(newPath, e.Action); ok {
-					fmt.Printf("[notify] waitForRenameToEvent(): new name is %q\n", oldPath)
-					fileChangeNotifier(newPath, e.Action, &event.AdditionalInfo{OldName: oldPath})
+				if action, ok := checkValidFile(newPath, e.Action); ok {
+					wt.fileDebug("DEBUG", fmt.Sprintf("file [%s] is renamed to [%s]", oldPath, newPath))
+					wt.fileChangeNotifier(newPath, action, &event.AdditionalInfo{OldName: oldPath}, nil)
 				}
 			}
-		case <-time.After(time.Second):
+		case <-wt.clock.After(time.Second):
 			return
 		}
 	}
@@ -1,52 +1,88 @@
+//go:build !integration && !fake
+
 #include "watch_linux.h"
 
 #include <stdio.h>
 #include <sys/inotify.h>
 #include <limits.h>
 #include <unistd.h>
-#include <dirent.h>
-#include <string.h>
-#include <pthread.h>
-
-#define BUF_LEN (10 * (sizeof(struct inotify_event) + 1024 + 1))
-
-void WatchDirectory(char* root, char* dir) {
-	int inotifyFd, wd, j;
-  	char buf[BUF_LEN] __attribute__ ((aligned(8)));
-  	ssize_t numRead;
-  	char *p;
-  	struct inotify_event *event;
-
-  	inotifyFd = inotify_init();
-  	if (inotifyFd == -1) {
-		printf("[CGO] [ERROR] inotify_init()");
-		exit(-1);
-   	}
-
-   	wd = inotify_add_watch(inotifyFd, dir, IN_CLOSE_WRITE | IN_DELETE);
-   	if (wd == -1) {
-		printf("[CGO] [ERROR] WatchDirectory(): inotify_add_watch()");
-		exit(-1);
+#include <errno.h>
+#include <poll.h>
+
+#define BUF_LEN (10 * (sizeof(struct inotify_event) + NAME_MAX + 1))
+
+// InitWatcher returns a new inotify file descriptor or -errno
+int InitWatcher() {
+	int inotifyFd = inotify_init1(IN_CLOEXEC);
+	if (inotifyFd == -1) {
+		return -errno;
 	}
+	return inotifyFd;
+}
 
-  	printf("[CGO] [INFO] WatchDirectory(): watching %s", dir);
-  	for (;;) {
-    	numRead = read(inotifyFd, buf, BUF_LEN);
-    	if (numRead == 0) {
-			printf("[CGO] [ERROR]: read() from inotify fd returned 0!");
-			exit(-1);
+// AddWatch returns the watch descriptor for the directory or -errno
+int AddWatch(int fd, char* dir, uint32_t mask) {
+	int wd = inotify_add_watch(fd, dir, mask);
+	if (wd == -1) {
+		return -errno;
+	}
+	return wd;
+}
+
+// RemoveWatch returns 0 or -errno
+int RemoveWatch(int fd, int wd) {
+	if (inotify_rm_watch(fd, wd) == -1) {
+		return -errno;
+	}
+	return 0;
+}
+
+// ReadEvents reads the inotify events until something is written to stopFd.
+// It returns 0 if it was stopped, 1 if the callback has asked to stop
+// and -errno if reading has failed.
+int ReadEvents(int id, int fd, int stopFd) {
+	char buf[BUF_LEN] __attribute__ ((aligned(__alignof__(struct inotify_event))));
+	ssize_t numRead;
+	char *p;
+	struct inotify_event *event;
+	struct pollfd fds[2];
+
+	fds[0].fd = fd;
+	fds[0].events = POLLIN;
+	fds[1].fd = stopFd;
+	fds[1].events = POLLIN;
+
+	for (;;) {
+		if (poll(fds, 2, -1) == -1) {
+			if (errno == EINTR) {
+				continue;
+			}
+			return -errno;
+		}
+		if (fds[1].revents != 0) {
+			return 0;
+		}
+		if ((fds[0].revents & POLLIN) == 0) {
+			continue;
 		}
 
-    	if (numRead == -1) {
-			printf("[CGO] [ERROR] read() from inotify fd returned -1");
-			exit(-1);
+		numRead = read(fd, buf, BUF_LEN);
+		if (numRead == -1) {
+			if (errno == EINTR || errno == EAGAIN) {
+				continue;
+			}
+			return -errno;
+		}
+		if (numRead == 0) {
+			return -EIO;
 		}
 
-    	for (p = buf; p < buf + numRead; ) {
+		for (p = buf; p < buf + numRead; ) {
 			event = (struct inotify_event *) p;
-			printf("[CGO] [INFO] file was changed: %s %s\n", dir, event->name);
-			goCallbackFileChange(root, dir, event->name, event->mask);
+			if (goCallbackFileChange(id, event->wd, event->len > 0 ? event->name : "", event->mask, event->cookie) != 0) {
+				return 1;
+			}
 			p += sizeof(struct inotify_event) + event->len;
-    	}
-  	}
+		}
+	}
 }
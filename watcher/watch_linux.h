@@ -2,8 +2,13 @@
 #define LIN_H_
 
 #include <stdlib.h>
+#include <stdint.h>
 
-void goCallbackFileChange(char* root, char* path, char* file, int action);
-void WatchDirectory(char* root, char* dir);
+int goCallbackFileChange(int id, int wd, char* file, uint32_t mask, uint32_t cookie);
 
-#endif
\ No newline at end of file
+int InitWatcher();
+int AddWatch(int fd, char* dir, uint32_t mask);
+int RemoveWatch(int fd, int wd);
+int ReadEvents(int id, int fd, int stopFd);
+
+#endif
@@ -1,3 +1,5 @@
+//go:build !integration && !fake
+
 #include "watch_windows.h"
 #include <windows.h>
 #include <stdio.h>
@@ -7,6 +9,10 @@
 #define INSTANCES 2
 #define PIPE_TIMEOUT 5000
 #define BUFSIZE 4096
+// the attribute and security changes are reported as FILE_ACTION_MODIFIED like the writes,
+// the Go side tells them apart by the metadata of the file
+#define NOTIFY_FILTER (FILE_NOTIFY_CHANGE_LAST_WRITE | FILE_NOTIFY_CHANGE_FILE_NAME | FILE_NOTIFY_CHANGE_DIR_NAME | \
+					   FILE_NOTIFY_CHANGE_ATTRIBUTES | FILE_NOTIFY_CHANGE_SECURITY)
 
 // Create the name pipe by the pipe name;
 HANDLE stopWatchHandle;
@@ -127,7 +133,7 @@ void WatchDirectory(char *dir)
 	handle = FindFirstChangeNotification(
 		dir,  // directory to watch
 		TRUE, // do watch subtree
-		FILE_NOTIFY_CHANGE_LAST_WRITE | FILE_NOTIFY_CHANGE_FILE_NAME | FILE_NOTIFY_CHANGE_DIR_NAME);
+		NOTIFY_FILTER);
 
 	ovlEventHandle.hEvent = CreateEvent(NULL, TRUE, FALSE, NULL);
 	HANDLE handles[] = {ovlEventHandle.hEvent, eventToChild};
@@ -144,7 +150,7 @@ void WatchDirectory(char *dir)
 		ExitProcess(GetLastError());
 	}
 
-	ReadDirectoryChangesW(handle, buffer, sizeof(buffer), FALSE, FILE_NOTIFY_CHANGE_LAST_WRITE, NULL, &ovlEventHandle, NULL);
+	ReadDirectoryChangesW(handle, buffer, sizeof(buffer), FALSE, NOTIFY_FILTER, NULL, &ovlEventHandle, NULL);
 	while (TRUE)
 	{
 		waitStatus = WaitForMultipleObjects(
@@ -192,7 +198,7 @@ void WatchDirectory(char *dir)
 			} while (fni->NextEntryOffset != 0);
 
 			ResetEvent(ovlEventHandle.hEvent);
-			if (ReadDirectoryChangesW(handle, buffer, sizeof(buffer), FALSE, FILE_NOTIFY_CHANGE_LAST_WRITE, NULL, &ovlEventHandle, NULL) == 0)
+			if (ReadDirectoryChangesW(handle, buffer, sizeof(buffer), FALSE, NOTIFY_FILTER, NULL, &ovlEventHandle, NULL) == 0)
 			{
 				printf("[CGO] [INFO] Reading Directory Change\n");
 			}